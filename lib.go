@@ -163,7 +163,9 @@ func InitDbByNode(pDb C.uintptr_t, data *C.uchar, sz C.int) *C.char {
 	if err != nil {
 		return C.CString(err.Error())
 	}
-	db.Init(hash[:], n.CanonicalValue())
+	if err := db.Put(hash[:], n.CanonicalValue()); err != nil {
+		return C.CString(err.Error())
+	}
 
 	return nil
 
@@ -184,6 +186,22 @@ func NewZkTrie(root_c *C.uchar, pDb C.uintptr_t) C.uintptr_t {
 	return C.uintptr_t(cgo.NewHandle(zktrie))
 }
 
+// same as NewZkTrie but the trie is read-only, any update on it returns an error
+// and nothing is written into the db
+//export NewZkTrieReadOnly
+func NewZkTrieReadOnly(root_c *C.uchar, pDb C.uintptr_t) C.uintptr_t {
+	h := cgo.Handle(pDb)
+	db := h.Value().(*trie.Database)
+	root := C.GoBytes(unsafe.Pointer(root_c), 32)
+
+	zktrie, err := trie.NewZkTrieReadOnly(*zkt.NewByte32FromBytes(root), db)
+	if err != nil {
+		return 0
+	}
+
+	return C.uintptr_t(cgo.NewHandle(zktrie))
+}
+
 // currently it is caller's responsibility to distinguish what
 // the returned buffer is byte32 or encoded account data (4x32bytes fields for original account
 // or 6x32bytes fields for 'dual-codehash' extended account)
@@ -206,38 +224,48 @@ func TrieGet(p C.uintptr_t, key_c *C.uchar, key_sz C.int) unsafe.Pointer {
 	return C.CBytes(v)
 }
 
-// update only accept encoded buffer, and flag is derived automatically from buffer size (account data or store val)
+// update only accept encoded buffer, and flag is derived automatically from buffer size (account data or store val),
+// an empty buffer deletes the leaf
 //export TrieUpdate
 func TrieUpdate(p C.uintptr_t, key_c *C.uchar, key_sz C.int, val_c *C.uchar, val_sz C.int) *C.char {
+	h := cgo.Handle(p)
+	tr := h.Value().(*trie.ZkTrie)
+	key := C.GoBytes(unsafe.Pointer(key_c), key_sz)
+	val := C.GoBytes(unsafe.Pointer(val_c), val_sz)
+
+	if err := trieUpdate(tr, key, val); err != nil {
+		return C.CString(err.Error())
+	}
+	return nil
+}
 
-	if val_sz != 32 && val_sz != 128 && val_sz != 160 {
-		return C.CString("unexpected buffer type")
+// trieUpdate updates the leaf with the value buffer, the flag is decided by
+// the size of the buffer and an empty buffer deletes the leaf
+func trieUpdate(tr *trie.ZkTrie, key []byte, val []byte) error {
+	if len(val) != 0 && len(val) != 32 && len(val) != 128 && len(val) != 160 {
+		return errors.New("unexpected buffer type")
 	}
 
 	var vFlag uint32
-	if val_sz == 160 {
-		vFlag = 8
-	} else if val_sz == 128 {
+	if len(val) == 160 {
+		vFlag = zkt.StateAccountFlag
+	} else if len(val) == 128 {
 		vFlag = 4
 	} else {
 		vFlag = 1
 	}
 
-	h := cgo.Handle(p)
-	tr := h.Value().(*trie.ZkTrie)
-	key := C.GoBytes(unsafe.Pointer(key_c), key_sz)
 	var vals []zkt.Byte32
-	start_ptr := uintptr(unsafe.Pointer(val_c))
-	for i := 0; i < int(val_sz); i += 32 {
-		vals = append(vals, *zkt.NewByte32FromBytes(C.GoBytes(unsafe.Pointer(start_ptr), 32)))
-		start_ptr += 32
+	for i := 0; i < len(val); i += 32 {
+		vals = append(vals, *zkt.NewByte32FromBytes(val[i : i+32]))
 	}
 
-	err := tr.TryUpdate(key, vFlag, vals)
-	if err != nil {
-		return C.CString(err.Error())
+	if err := tr.TryUpdate(key, vFlag, vals); err != nil {
+		return err
 	}
-	return nil
+	// the db is shared with other tries so the update is committed at once
+	_, _, err := tr.Commit()
+	return err
 }
 
 // delete leaf, silently omit any error
@@ -246,7 +274,9 @@ func TrieDelete(p C.uintptr_t, key_c *C.uchar, key_sz C.int) {
 	h := cgo.Handle(p)
 	tr := h.Value().(*trie.ZkTrie)
 	key := C.GoBytes(unsafe.Pointer(key_c), key_sz)
-	tr.TryDelete(key)
+	if err := tr.TryDelete(key); err == nil {
+		tr.Commit()
+	}
 }
 
 // output prove, only the val part is output for callback
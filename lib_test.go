@@ -0,0 +1,36 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/scroll-tech/zktrie/trie"
+	zkt "github.com/scroll-tech/zktrie/types"
+)
+
+func TestTrieUpdate(t *testing.T) {
+	tr, err := trie.NewZkTrie(zkt.Byte32{}, trie.NewZkTrieMemoryDb())
+	assert.NoError(t, err)
+
+	key := make([]byte, 20)
+	key[0] = 1
+	val := make([]byte, 32)
+	val[31] = 1
+	assert.NoError(t, trieUpdate(tr, key, val))
+	got, err := tr.TryGet(key)
+	assert.NoError(t, err)
+	assert.Equal(t, val, got)
+
+	assert.Error(t, trieUpdate(tr, key, make([]byte, 33)))
+
+	// an empty buffer deletes the leaf
+	assert.NoError(t, trieUpdate(tr, key, nil))
+	assert.Equal(t, zkt.HashZero.Bytes(), tr.Hash())
+	got, err = tr.TryGet(key)
+	assert.NoError(t, err)
+	assert.Nil(t, got)
+
+	// deleting an unexisted key is not an error
+	assert.NoError(t, trieUpdate(tr, key, []byte{}))
+}
@@ -38,6 +38,7 @@ extern "C" {
     fn NewMemoryDb() -> *mut MemoryDb;
     fn InitDbByNode(db: *mut MemoryDb, data: *const u8, sz: c_int) -> *const c_char;
     fn NewZkTrie(root: *const u8, db: *const MemoryDb) -> *mut Trie;
+    fn NewZkTrieReadOnly(root: *const u8, db: *const MemoryDb) -> *mut Trie;
     fn FreeMemoryDb(db: *mut MemoryDb);
     fn FreeZkTrie(trie: *mut Trie);
     fn FreeBuffer(p: *const c_void);
@@ -187,6 +188,17 @@ impl ZkMemoryDb {
             Some(ZkTrie { trie: ret })
         }
     }
+
+    // same as new_trie but any update on the returned trie fails
+    pub fn new_trie_readonly(&mut self, root: &Hash) -> Option<ZkTrie> {
+        let ret = unsafe { NewZkTrieReadOnly(root.as_ptr(), self.db) };
+
+        if ret.is_null() {
+            None
+        } else {
+            Some(ZkTrie { trie: ret })
+        }
+    }
 }
 
 impl Default for ZkMemoryDb {
@@ -291,6 +303,11 @@ impl ZkTrie {
         self.update(key, acc_buf)
     }
 
+    // delete the leaf by updating it with an empty value
+    pub fn update_empty(&mut self, key: &[u8]) -> Result<(), ErrString> {
+        self.update::<0>(key, &[])
+    }
+
     pub fn delete(&mut self, key: &[u8]) {
         unsafe {
             TrieDelete(self.trie, key.as_ptr(), key.len() as c_int);
@@ -418,6 +435,25 @@ mod tests {
         }
     }
 
+    #[test]
+    fn trie_update_empty() {
+        init_hash_scheme(hash_scheme);
+        let mut db = ZkMemoryDb::new();
+        let mut trie = db.new_trie(&[0; HASHLEN]).unwrap();
+
+        let key = hex::decode("4cb1aB63aF5D8931Ce09673EbD8ae2ce16fD6571").unwrap();
+        let mut val: StoreData = [0; FIELDSIZE];
+        val[31] = 1;
+        trie.update_store(&key, &val).unwrap();
+        assert_eq!(trie.get_store(&key), Some(val));
+
+        trie.update_empty(&key).unwrap();
+        assert_eq!(trie.get_store(&key), None);
+        assert_eq!(trie.root(), [0; HASHLEN]);
+        // deleting an unexisted key is not an error
+        trie.update_empty(&key).unwrap();
+    }
+
     #[cfg(not(feature = "dual_codehash"))]
     #[test]
     fn trie_works() {
@@ -18,6 +18,7 @@ package trie
 
 import (
 	"bytes"
+	"errors"
 	"math/big"
 
 	zkt "github.com/scroll-tech/zktrie/types"
@@ -32,7 +33,7 @@ import (
 // New and must have an attached database. The database also stores
 // the preimage of each key.
 //
-// ZkTrie is not safe for concurrent use.
+// ZkTrie is not safe for concurrent use, SafeZkTrie can be used instead.
 type ZkTrie struct {
 	tree *ZkTrieImpl
 }
@@ -46,12 +47,26 @@ type ZkTrie struct {
 // causing a soundness issue in the zk circuit.
 const NodeKeyValidBytes = 31
 
+// storageValueFlag is the compression flag of a storage value, which is a
+// single 32 bytes field that can not be treated as a field element
+const storageValueFlag = 1
+
+// ErrInvalidStorageValue is returned when the value of a storage slot is not
+// a single 32 bytes field
+var ErrInvalidStorageValue = errors.New("invalid storage value")
+
 // NewSecure creates a trie
 // SecureBinaryTrie bypasses all the buffer mechanism in *Database, it directly uses the
 // underlying diskdb
 func NewZkTrie(root zkt.Byte32, db ZktrieDatabase) (*ZkTrie, error) {
+	return NewZkTrieWithHasher(root, db, zkt.DefaultHasher)
+}
+
+// NewZkTrieWithHasher creates a trie which use the specified hash scheme for
+// both the secure key and the node hashes
+func NewZkTrieWithHasher(root zkt.Byte32, db ZktrieDatabase, hasher zkt.Hasher) (*ZkTrie, error) {
 	maxLevels := NodeKeyValidBytes * 8
-	tree, err := NewZkTrieImplWithRoot((db), zkt.NewHashFromBytes(root.Bytes()), maxLevels)
+	tree, err := NewZkTrieImplWithRootAndHasher((db), zkt.NewHashFromBytes(root.Bytes()), maxLevels, hasher)
 	if err != nil {
 		return nil, err
 	}
@@ -60,11 +75,34 @@ func NewZkTrie(root zkt.Byte32, db ZktrieDatabase) (*ZkTrie, error) {
 	}, nil
 }
 
+// NewZkTrieReadOnly creates a read-only trie, any attempt to modify it returns
+// ErrNotWritable and nothing is written into db, including the key preimages
+func NewZkTrieReadOnly(root zkt.Byte32, db ZktrieDatabase) (*ZkTrie, error) {
+	return NewZkTrieReadOnlyWithHasher(root, db, zkt.DefaultHasher)
+}
+
+// NewZkTrieReadOnlyWithHasher is the same as NewZkTrieReadOnly but use the specified hash scheme
+func NewZkTrieReadOnlyWithHasher(root zkt.Byte32, db ZktrieDatabase, hasher zkt.Hasher) (*ZkTrie, error) {
+	t, err := NewZkTrieWithHasher(root, db, hasher)
+	if err != nil {
+		return nil, err
+	}
+	t.tree.writable = false
+	return t, nil
+}
+
+// AsReadOnly returns a read-only view of the trie, see ZkTrieImpl.AsReadOnly
+func (t *ZkTrie) AsReadOnly() *ZkTrie {
+	return &ZkTrie{
+		tree: t.tree.AsReadOnly(),
+	}
+}
+
 // TryGet returns the value for key stored in the trie.
 // The value bytes must not be modified by the caller.
 // If a node was not found in the database, a MissingNodeError is returned.
 func (t *ZkTrie) TryGet(key []byte) ([]byte, error) {
-	k, err := zkt.ToSecureKey(key)
+	k, err := zkt.ToSecureKeyWithHasher(t.tree.hasher, key)
 	if err != nil {
 		return nil, err
 	}
@@ -77,10 +115,19 @@ func (t *ZkTrie) Tree() *ZkTrieImpl {
 	return t.tree
 }
 
-// TryGetNode attempts to retrieve a trie node by compact-encoded path. It is not
-// possible to use keybyte-encoding as the path might contain odd nibbles.
+// TryGetNode attempts to retrieve a trie node by binary path encoded by
+// EncodeBinaryPath. It returns the canonical bytes of the node and the number
+// of path bits being resolved, the node is nil if it is not existed
 func (t *ZkTrie) TryGetNode(path []byte) ([]byte, int, error) {
-	panic("unimplemented")
+	bits, err := DecodeBinaryPath(path)
+	if err != nil {
+		return nil, 0, err
+	}
+	n, resolved, err := t.tree.GetNodeByPath(bits)
+	if err != nil || n == nil {
+		return nil, resolved, err
+	}
+	return n.CanonicalValue(), resolved, nil
 }
 
 func (t *ZkTrie) updatePreimage(preimage []byte, hashField *big.Int) {
@@ -96,9 +143,20 @@ func (t *ZkTrie) updatePreimage(preimage []byte, hashField *big.Int) {
 //
 // If a node was not found in the database, a MissingNodeError is returned.
 //
-// NOTE: value is restricted to length of bytes32.
+// NOTE: value is restricted to length of bytes32, and at most 255 of them
+// (ErrInvalidValuePreimage is returned otherwise).
 func (t *ZkTrie) TryUpdate(key []byte, vFlag uint32, vPreimage []zkt.Byte32) error {
-	k, err := zkt.ToSecureKey(key)
+	// the preimage is written before updating, so check it first
+	if !t.tree.writable {
+		return ErrNotWritable
+	}
+	if len(vPreimage) == 0 {
+		return t.TryDelete(key)
+	}
+	if err := checkValuePreimage(vPreimage); err != nil {
+		return err
+	}
+	k, err := zkt.ToSecureKeyWithHasher(t.tree.hasher, key)
 	if err != nil {
 		return err
 	}
@@ -109,7 +167,10 @@ func (t *ZkTrie) TryUpdate(key []byte, vFlag uint32, vPreimage []zkt.Byte32) err
 // TryDelete removes any existing value for key from the trie.
 // If a node was not found in the database, a MissingNodeError is returned.
 func (t *ZkTrie) TryDelete(key []byte) error {
-	k, err := zkt.ToSecureKey(key)
+	if !t.tree.writable {
+		return ErrNotWritable
+	}
+	k, err := zkt.ToSecureKeyWithHasher(t.tree.hasher, key)
 	if err != nil {
 		return err
 	}
@@ -123,20 +184,86 @@ func (t *ZkTrie) TryDelete(key []byte) error {
 	return t.tree.TryDelete(kHash)
 }
 
+// GetAccount returns the state account for key, or nil if it is not existed.
+// An error is returned if the value of key is not a marshaled state account
+func (t *ZkTrie) GetAccount(key []byte) (*zkt.StateAccount, error) {
+	k, err := zkt.ToSecureKeyWithHasher(t.tree.hasher, key)
+	if err != nil {
+		return nil, err
+	}
+
+	n, err := t.tree.GetLeafNode(zkt.NewHashFromBigInt(k))
+	if err == ErrKeyNotFound {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	acc := new(zkt.StateAccount)
+	if err := acc.Unmarshal(n.CompressedFlags, n.ValuePreimage); err != nil {
+		return nil, err
+	}
+	return acc, nil
+}
+
+// UpdateAccount associates key with the marshaled state account in the trie
+func (t *ZkTrie) UpdateAccount(key []byte, acc *zkt.StateAccount) error {
+	if err := acc.Validate(); err != nil {
+		return err
+	}
+	vFlag, vPreimage := acc.Marshal()
+	return t.TryUpdate(key, vFlag, vPreimage)
+}
+
+// GetStorage returns the value of the storage slot, or a zero value if the
+// slot is not existed
+func (t *ZkTrie) GetStorage(slot []byte) (zkt.Byte32, error) {
+	k, err := zkt.ToSecureKeyWithHasher(t.tree.hasher, slot)
+	if err != nil {
+		return zkt.Byte32{}, err
+	}
+
+	n, err := t.tree.GetLeafNode(zkt.NewHashFromBigInt(k))
+	if err == ErrKeyNotFound {
+		return zkt.Byte32{}, nil
+	} else if err != nil {
+		return zkt.Byte32{}, err
+	}
+	if n.CompressedFlags != storageValueFlag || len(n.ValuePreimage) != 1 {
+		return zkt.Byte32{}, ErrInvalidStorageValue
+	}
+	return n.ValuePreimage[0], nil
+}
+
+// UpdateStorage sets the value of the storage slot, a zero value deletes the
+// slot from the trie
+func (t *ZkTrie) UpdateStorage(slot []byte, value zkt.Byte32) error {
+	if value == (zkt.Byte32{}) {
+		return t.DeleteStorage(slot)
+	}
+	return t.TryUpdate(slot, storageValueFlag, []zkt.Byte32{value})
+}
+
+// DeleteStorage removes the storage slot from the trie
+func (t *ZkTrie) DeleteStorage(slot []byte) error {
+	return t.TryDelete(slot)
+}
+
 // Hash returns the root hash of SecureBinaryTrie. It does not write to the
 // database and can be used even if the trie doesn't have one.
 func (t *ZkTrie) Hash() []byte {
 	return t.tree.rootHash.Bytes()
 }
 
+// Commit writes all the uncommitted nodes reachable from the root into the
+// database and returns the root hash along with the written nodes
+func (t *ZkTrie) Commit() (*zkt.Hash, *NodeSet, error) {
+	return t.tree.Commit()
+}
+
 // Copy returns a copy of SecureBinaryTrie.
 func (t *ZkTrie) Copy() *ZkTrie {
-	cpy, err := NewZkTrieImplWithRoot(t.tree.db, t.tree.rootHash, t.tree.maxLevels)
-	if err != nil {
-		panic("clone trie failed")
-	}
 	return &ZkTrie{
-		tree: cpy,
+		tree: t.tree.Copy(),
 	}
 }
 
@@ -145,6 +272,22 @@ func (t *ZkTrie) Prove(key []byte, fromLevel uint, writeNode func(*Node) error)
 	return t.ProveWithDeletion(key, fromLevel, writeNode, nil)
 }
 
+// ProveMulti constructs a merkle proof for multiple keys in one pass. Each node
+// on the paths of the keys is written only once, so the nodes shared by the
+// keys (e.g. the upper levels of the trie) are not duplicated in the proof.
+// The proof can be checked by VerifyMultiProof
+func (t *ZkTrie) ProveMulti(keys [][]byte, writeNode func(*Node) error) error {
+	kHashes := make([]*zkt.Hash, 0, len(keys))
+	for _, key := range keys {
+		k, err := zkt.NewHashFromCheckedBytes(key)
+		if err != nil {
+			return err
+		}
+		kHashes = append(kHashes, k)
+	}
+	return t.tree.proveMulti(kHashes, writeNode)
+}
+
 // ProveWithDeletion constructs a merkle proof for key. The result contains all encoded nodes
 // on the path to the value at key. The value itself is also included in the last
 // node and can be retrieved by verifying the proof.
@@ -190,7 +333,7 @@ func (t *ZkTrie) ProveWithDeletion(key []byte, fromLevel uint, writeNode func(*N
 				onHit(n, nil)
 			} else {
 				var sibling, nHash *zkt.Hash
-				nHash, err = n.NodeHash()
+				nHash, err = n.NodeHashWithHasher(t.tree.hasher)
 				if err != nil {
 					return
 				}
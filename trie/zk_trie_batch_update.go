@@ -0,0 +1,255 @@
+package trie
+
+import (
+	"bytes"
+	"errors"
+	"runtime"
+	"sync"
+
+	zkt "github.com/scroll-tech/zktrie/types"
+)
+
+// ErrInvalidBatch is returned when the keys and values of a batch update have
+// different lengths
+var ErrInvalidBatch = errors.New("keys and values of the batch have different lengths")
+
+// LeafValue is the value of a leaf, i.e. the vFlag and vPreimage of TryUpdate
+type LeafValue struct {
+	Flag     uint32
+	Preimage []zkt.Byte32
+}
+
+// batchNode is a node created by the batch update, waiting to be put into the
+// dirty set
+type batchNode struct {
+	node   *Node
+	update bool // replaces an existing leaf with the same key
+}
+
+type batchResult struct {
+	hash  *zkt.Hash
+	nodes []batchNode
+	err   error
+}
+
+type batchUpdater struct {
+	mt  *ZkTrieImpl
+	sem chan struct{}
+}
+
+// BatchUpdate updates multiple nodeKeys & values into the ZkTrieImpl, the
+// result is identical to calling TryUpdate for each of them in order (the last
+// one wins for duplicated keys, and an empty value deletes the key). The
+// updates are partitioned by their paths, and the disjoint subtrees are
+// updated and hashed concurrently on a worker pool bounded by GOMAXPROCS. The
+// new nodes are put into the dirty set only if all the hashes are calculated
+// successfully. The deletions are applied one by one after that
+func (mt *ZkTrieImpl) BatchUpdate(nodeKeys []*zkt.Hash, values []LeafValue) error {
+	// verify that the ZkTrieImpl is writable
+	if !mt.writable {
+		return ErrNotWritable
+	}
+	if len(nodeKeys) != len(values) {
+		return ErrInvalidBatch
+	}
+
+	// the leaf of a key to be deleted is nil
+	index := make(map[zkt.Hash]int, len(nodeKeys))
+	keys := make([]*zkt.Hash, 0, len(nodeKeys))
+	leaves := make([]*Node, 0, len(nodeKeys))
+	for i, nodeKey := range nodeKeys {
+		// verify that k are valid and fit inside the Finite Field.
+		if !zkt.CheckBigIntInField(nodeKey.BigInt()) {
+			return ErrInvalidField
+		}
+		var leaf *Node
+		if len(values[i].Preimage) != 0 {
+			if err := checkValuePreimage(values[i].Preimage); err != nil {
+				return err
+			}
+			leaf = NewLeafNode(nodeKey, values[i].Flag, values[i].Preimage)
+		}
+		if j, ok := index[*nodeKey]; ok {
+			leaves[j] = leaf
+			continue
+		}
+		index[*nodeKey] = len(leaves)
+		keys = append(keys, nodeKey)
+		leaves = append(leaves, leaf)
+	}
+
+	var inserts []*Node
+	var deletes []*zkt.Hash
+	for i, leaf := range leaves {
+		if leaf == nil {
+			deletes = append(deletes, keys[i])
+		} else {
+			inserts = append(inserts, leaf)
+		}
+	}
+	if len(deletes) == 0 {
+		return mt.batchInsert(inserts)
+	}
+
+	// work on a copy so nothing is changed if any deletion fails
+	cpy := mt.Copy()
+	if err := cpy.batchInsert(inserts); err != nil {
+		return err
+	}
+	for _, nodeKey := range deletes {
+		if err := cpy.TryDelete(nodeKey); err != nil && err != ErrKeyNotFound {
+			return err
+		}
+	}
+	mt.rootHash, mt.dirty = cpy.rootHash, cpy.dirty
+	return nil
+}
+
+// batchInsert adds or replaces the leaves with distinct node keys
+func (mt *ZkTrieImpl) batchInsert(leaves []*Node) error {
+	if len(leaves) == 0 {
+		return nil
+	}
+
+	u := &batchUpdater{mt: mt, sem: make(chan struct{}, runtime.GOMAXPROCS(0)-1)}
+	res := u.update(mt.rootHash, 0, leaves, nil)
+	if res.err != nil {
+		return res.err
+	}
+
+	for _, n := range res.nodes {
+		var err error
+		if n.update {
+			_, err = mt.updateNode(n.node)
+		} else {
+			_, err = mt.addNode(n.node)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	mt.rootHash = res.hash
+	return nil
+}
+
+// update applies the leaves to the subtree with nodeHash at depth, old is the
+// existing leaf being pushed down which is already in the tree. It only reads
+// the MT so it can be run concurrently
+func (u *batchUpdater) update(nodeHash *zkt.Hash, depth int, leaves []*Node, old *Node) batchResult {
+	if len(leaves) == 0 {
+		return batchResult{hash: nodeHash}
+	}
+	if depth > u.mt.maxLevels-1 {
+		return batchResult{err: ErrReachedMaxLevel}
+	}
+
+	n, err := u.mt.GetNode(nodeHash)
+	if err != nil {
+		return batchResult{err: err}
+	}
+	switch n.Type {
+	case NodeTypeEmpty:
+		if len(leaves) == 1 {
+			hash, err := leaves[0].NodeHashWithHasher(u.mt.hasher)
+			if err != nil || leaves[0] == old {
+				// the existing leaf is already in the tree
+				return batchResult{hash: hash, err: err}
+			}
+			return batchResult{hash: hash, nodes: []batchNode{{node: leaves[0]}}}
+		}
+		if depth > u.mt.maxLevels-2 {
+			return batchResult{err: ErrReachedMaxLevel}
+		}
+		return u.split(&zkt.HashZero, &zkt.HashZero, depth, leaves, old)
+	case NodeTypeLeaf:
+		merged := leaves
+		replaced := -1
+		for i, leaf := range leaves {
+			if bytes.Equal(leaf.NodeKey[:], n.NodeKey[:]) {
+				replaced = i
+				break
+			}
+		}
+		if replaced < 0 {
+			// push down the existing leaf along with the new ones
+			old = n
+			merged = append(append(make([]*Node, 0, len(leaves)+1), leaves...), n)
+		}
+		if len(merged) == 1 {
+			hash, err := merged[0].NodeHashWithHasher(u.mt.hasher)
+			if err != nil {
+				return batchResult{err: err}
+			}
+			if bytes.Equal(hash[:], nodeHash[:]) {
+				// duplicate entry
+				return batchResult{hash: hash}
+			}
+			return batchResult{hash: hash, nodes: []batchNode{{node: merged[0], update: true}}}
+		}
+		if depth > u.mt.maxLevels-2 {
+			return batchResult{err: ErrReachedMaxLevel}
+		}
+		res := u.split(&zkt.HashZero, &zkt.HashZero, depth, merged, old)
+		if res.err == nil && replaced >= 0 {
+			for i := range res.nodes {
+				if res.nodes[i].node == leaves[replaced] {
+					res.nodes[i].update = true
+				}
+			}
+		}
+		return res
+	case NodeTypeParent:
+		return u.split(n.ChildL, n.ChildR, depth, leaves, old)
+	default:
+		return batchResult{err: ErrInvalidNodeFound}
+	}
+}
+
+// split partitions the leaves by the path bit at depth and updates both
+// children, concurrently if a worker is available
+func (u *batchUpdater) split(childL, childR *zkt.Hash, depth int, leaves []*Node, old *Node) batchResult {
+	var leftLeaves, rightLeaves []*Node
+	for _, leaf := range leaves {
+		if zkt.TestBit(leaf.NodeKey[:], uint(depth)) {
+			rightLeaves = append(rightLeaves, leaf)
+		} else {
+			leftLeaves = append(leftLeaves, leaf)
+		}
+	}
+
+	var left, right batchResult
+	if len(leftLeaves) != 0 && len(rightLeaves) != 0 {
+		select {
+		case u.sem <- struct{}{}:
+			var wg sync.WaitGroup
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				left = u.update(childL, depth+1, leftLeaves, old)
+				<-u.sem
+			}()
+			right = u.update(childR, depth+1, rightLeaves, old)
+			wg.Wait()
+		default:
+			left = u.update(childL, depth+1, leftLeaves, old)
+			right = u.update(childR, depth+1, rightLeaves, old)
+		}
+	} else {
+		left = u.update(childL, depth+1, leftLeaves, old)
+		right = u.update(childR, depth+1, rightLeaves, old)
+	}
+	if left.err != nil {
+		return left
+	}
+	if right.err != nil {
+		return right
+	}
+
+	parent := NewParentNode(left.hash, right.hash)
+	hash, err := parent.NodeHashWithHasher(u.mt.hasher)
+	if err != nil {
+		return batchResult{err: err}
+	}
+	nodes := append(append(left.nodes, right.nodes...), batchNode{node: parent})
+	return batchResult{hash: hash, nodes: nodes}
+}
@@ -0,0 +1,87 @@
+package trie
+
+import (
+	"math/rand"
+	"testing"
+
+	zkt "github.com/scroll-tech/zktrie/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestZkTrieImpl_BatchUpdate(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	randKey := func() *zkt.Hash {
+		var k zkt.Byte32
+		r.Read(k[1:])
+		return zkt.NewHashFromBytes(k[:])
+	}
+
+	existing := make([]*zkt.Hash, 64)
+	for i := range existing {
+		existing[i] = randKey()
+	}
+
+	for _, num := range []int{1, 2, 10, 200} {
+		serial, err := NewZkTrieImpl(NewZkTrieMemoryDb(), NodeKeyValidBytes*8)
+		assert.NoError(t, err)
+		batch, err := NewZkTrieImpl(NewZkTrieMemoryDb(), NodeKeyValidBytes*8)
+		assert.NoError(t, err)
+		for i, k := range existing[:num%64] {
+			assert.NoError(t, serial.TryUpdate(k, 0, []zkt.Byte32{{byte(i)}}))
+			assert.NoError(t, batch.TryUpdate(k, 0, []zkt.Byte32{{byte(i)}}))
+		}
+		_, _, err = batch.Commit()
+		assert.NoError(t, err)
+
+		// new keys, updates of existing keys, duplicated keys and deletions
+		var keys []*zkt.Hash
+		var values []LeafValue
+		for i := 0; i < num; i++ {
+			k := randKey()
+			value := LeafValue{Flag: 1, Preimage: []zkt.Byte32{{byte(i), 1}}}
+			switch i % 4 {
+			case 1:
+				k = existing[i%64]
+			case 2:
+				if len(keys) > 0 {
+					k = keys[i/2]
+				}
+			case 3:
+				k = existing[(i/4)%64]
+				value = LeafValue{}
+			}
+			keys = append(keys, k)
+			values = append(values, value)
+		}
+
+		for i, k := range keys {
+			assert.NoError(t, serial.TryUpdate(k, values[i].Flag, values[i].Preimage))
+		}
+		assert.NoError(t, batch.BatchUpdate(keys, values))
+		assert.Equal(t, serial.Root(), batch.Root(), "keys %d", num)
+
+		serialRoot, serialSet, err := serial.Commit()
+		assert.NoError(t, err)
+		batchRoot, _, err := batch.Commit()
+		assert.NoError(t, err)
+		assert.Equal(t, serialRoot, batchRoot)
+		for nodeHash := range serialSet.Nodes {
+			nodeHash := nodeHash
+			_, err := batch.GetNode(&nodeHash)
+			assert.NoError(t, err)
+		}
+	}
+}
+
+func TestZkTrieImpl_BatchUpdateInvalid(t *testing.T) {
+	mt, err := NewZkTrieImpl(NewZkTrieMemoryDb(), 10)
+	assert.NoError(t, err)
+	assert.Equal(t, ErrInvalidBatch, mt.BatchUpdate([]*zkt.Hash{zkt.NewHashFromBytes([]byte{1})}, nil))
+
+	// the paths diverge beyond the max levels, nothing is changed
+	keys := []*zkt.Hash{zkt.NewHashFromBytes([]byte{0b01}), zkt.NewHashFromBytes([]byte{0b10, 0b01})}
+	values := []LeafValue{{Preimage: []zkt.Byte32{{1}}}, {Preimage: []zkt.Byte32{{2}}}}
+	assert.Equal(t, ErrReachedMaxLevel, mt.BatchUpdate(keys, values))
+	assert.Equal(t, &zkt.HashZero, mt.Root())
+	assert.Equal(t, 0, len(mt.dirty))
+}
@@ -1,22 +1,88 @@
 package trie
 
 import (
+	"errors"
 	"math/big"
 	"sync"
+
+	zkt "github.com/scroll-tech/zktrie/types"
 )
 
+// ErrDeleteNotSupported is returned when deleting from a database which
+// does not support deletion
+var ErrDeleteNotSupported = errors.New("the database does not support deletion")
+
 type ZktrieDatabase interface {
 	UpdatePreimage(preimage []byte, hashField *big.Int)
+	// Preimage returns the preimage recorded by UpdatePreimage for hashField
+	Preimage(hashField *big.Int) ([]byte, bool)
 	Put(k, v []byte) error
 	Get(key []byte) ([]byte, error)
 }
 
+// idealBatchSize is the amount of data to be flushed in one batch when the
+// writes are not required to be atomic as a whole
+const idealBatchSize = 1024 * 1024
+
+// Batch is a write-only set of changes which are applied to the database
+// atomically when Write is called
+type Batch interface {
+	Put(k, v []byte) error
+	Delete(k []byte) error
+	// ValueSize returns the amount of data in the batch
+	ValueSize() int
+	Write() error
+	// Reset clears the batch for reuse
+	Reset()
+}
+
+// Batcher is an optional extension of ZktrieDatabase, the trie writes its nodes
+// through a batch if the database supports it
+type Batcher interface {
+	NewBatch() Batch
+}
+
+// Iteratee is an optional extension of ZktrieDatabase for the backends which
+// can enumerate all of their entries
+type Iteratee interface {
+	// ForEach calls fn for each k/v in the db in no particular order, it stops
+	// and returns the error once fn returns one. fn must not modify the db
+	ForEach(fn func(k, v []byte) error) error
+}
+
+// NodeReader is an optional extension of ZktrieDatabase for the backends
+// which provide decoded nodes directly (e.g. NodeCache), the trie resolves
+// the nodes through it instead of decoding the bytes from Get
+type NodeReader interface {
+	GetNode(nodeHash *zkt.Hash) (*Node, error)
+}
+
 type Database struct {
-	db   map[string][]byte
-	lock sync.RWMutex
+	db        map[string][]byte
+	preimages map[zkt.Hash][]byte // kept apart from the nodes
+	lock      sync.RWMutex
 }
 
-func (db *Database) UpdatePreimage([]byte, *big.Int) {}
+func (db *Database) UpdatePreimage(preimage []byte, hashField *big.Int) {
+	if hashField == nil {
+		return
+	}
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	db.preimages[*zkt.NewHashFromBigInt(hashField)] = append([]byte{}, preimage...)
+}
+
+func (db *Database) Preimage(hashField *big.Int) ([]byte, bool) {
+	if hashField == nil {
+		return nil, false
+	}
+	db.lock.RLock()
+	defer db.lock.RUnlock()
+
+	preimage, ok := db.preimages[*zkt.NewHashFromBigInt(hashField)]
+	return preimage, ok
+}
 
 func (db *Database) Put(k, v []byte) error {
 	db.lock.Lock()
@@ -37,13 +103,107 @@ func (db *Database) Get(key []byte) ([]byte, error) {
 
 }
 
-// Init flush db with batches of k/v without locking
-func (db *Database) Init(k, v []byte) {
-	db.db[string(k)] = v
+func (db *Database) ForEach(fn func(k, v []byte) error) error {
+	db.lock.RLock()
+	defer db.lock.RUnlock()
+
+	for k, v := range db.db {
+		if err := fn([]byte(k), v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (db *Database) NewBatch() Batch {
+	return &memoryBatch{db: db}
 }
 
 func NewZkTrieMemoryDb() *Database {
 	return &Database{
-		db: make(map[string][]byte),
+		db:        make(map[string][]byte),
+		preimages: make(map[zkt.Hash][]byte),
 	}
 }
+
+type keyvalue struct {
+	key    []byte
+	value  []byte
+	delete bool
+}
+
+type memoryBatch struct {
+	db     *Database
+	writes []keyvalue
+	size   int
+}
+
+func (b *memoryBatch) Put(k, v []byte) error {
+	b.writes = append(b.writes, keyvalue{key: k, value: v})
+	b.size += len(k) + len(v)
+	return nil
+}
+
+func (b *memoryBatch) Delete(k []byte) error {
+	b.writes = append(b.writes, keyvalue{key: k, delete: true})
+	b.size += len(k)
+	return nil
+}
+
+func (b *memoryBatch) ValueSize() int {
+	return b.size
+}
+
+func (b *memoryBatch) Write() error {
+	b.db.lock.Lock()
+	defer b.db.lock.Unlock()
+
+	for _, kv := range b.writes {
+		if kv.delete {
+			delete(b.db.db, string(kv.key))
+		} else {
+			b.db.db[string(kv.key)] = kv.value
+		}
+	}
+	return nil
+}
+
+func (b *memoryBatch) Reset() {
+	b.writes = b.writes[:0]
+	b.size = 0
+}
+
+// putBatch is a non-atomic batch for the db does not implement Batcher
+type putBatch struct {
+	db     ZktrieDatabase
+	writes []keyvalue
+	size   int
+}
+
+func (b *putBatch) Put(k, v []byte) error {
+	b.writes = append(b.writes, keyvalue{key: k, value: v})
+	b.size += len(k) + len(v)
+	return nil
+}
+
+func (b *putBatch) Delete([]byte) error {
+	return ErrDeleteNotSupported
+}
+
+func (b *putBatch) ValueSize() int {
+	return b.size
+}
+
+func (b *putBatch) Write() error {
+	for _, kv := range b.writes {
+		if err := b.db.Put(kv.key, kv.value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (b *putBatch) Reset() {
+	b.writes = b.writes[:0]
+	b.size = 0
+}
@@ -2,20 +2,24 @@ package trie
 
 import (
 	"fmt"
+	"math/big"
 	"sync"
 	"testing"
 
+	zkt "github.com/scroll-tech/zktrie/types"
 	"github.com/stretchr/testify/assert"
 )
 
 func TestDatabase(t *testing.T) {
 	db := NewZkTrieMemoryDb()
 	db.UpdatePreimage(nil, nil)
+	batch := db.NewBatch()
 	for i := 0; i < 100; i++ {
 		key := []byte(fmt.Sprintf("key_%d", i))
 		value := []byte(fmt.Sprintf("value_%d", i))
-		db.Init(key, value)
+		assert.NoError(t, batch.Put(key, value))
 	}
+	assert.NoError(t, batch.Write())
 
 	var wg sync.WaitGroup
 	wg.Add(3)
@@ -53,3 +57,74 @@ func TestDatabase(t *testing.T) {
 
 	wg.Wait()
 }
+
+func TestDatabase_Batch(t *testing.T) {
+	db := NewZkTrieMemoryDb()
+	assert.NoError(t, db.Put([]byte("key_0"), []byte("value_0")))
+
+	batch := db.NewBatch()
+	assert.NoError(t, batch.Put([]byte("key_1"), []byte("value_1")))
+	assert.NoError(t, batch.Delete([]byte("key_0")))
+	assert.Equal(t, 17, batch.ValueSize())
+
+	// nothing is applied before Write
+	_, err := db.Get([]byte("key_1"))
+	assert.Equal(t, ErrKeyNotFound, err)
+
+	assert.NoError(t, batch.Write())
+	_, err = db.Get([]byte("key_0"))
+	assert.Equal(t, ErrKeyNotFound, err)
+	value, err := db.Get([]byte("key_1"))
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("value_1"), value)
+
+	batch.Reset()
+	assert.Equal(t, 0, batch.ValueSize())
+	assert.NoError(t, batch.Put([]byte("key_2"), []byte("value_2")))
+	assert.NoError(t, batch.Write())
+	assert.Equal(t, 2, len(db.db))
+}
+
+func TestDatabase_Preimage(t *testing.T) {
+	db := NewZkTrieMemoryDb()
+	_, ok := db.Preimage(big.NewInt(1))
+	assert.False(t, ok)
+	_, ok = db.Preimage(nil)
+	assert.False(t, ok)
+
+	preimage := []byte("key")
+	db.UpdatePreimage(preimage, big.NewInt(1))
+	preimage[0] = 'x'
+	got, ok := db.Preimage(big.NewInt(1))
+	assert.True(t, ok)
+	assert.Equal(t, []byte("key"), got)
+
+	// recorded through ZkTrie
+	zkTrie, err := NewZkTrie(zkt.Byte32{}, db)
+	assert.NoError(t, err)
+	assert.NoError(t, zkTrie.TryUpdate([]byte("account"), 1, []zkt.Byte32{{1}}))
+	k, err := zkt.ToSecureKey([]byte("account"))
+	assert.NoError(t, err)
+	got, ok = db.Preimage(k)
+	assert.True(t, ok)
+	assert.Equal(t, []byte("account"), got)
+
+	it := zkTrie.Tree().NewLeafIterator(nil)
+	assert.True(t, it.Next())
+	got, ok = it.KeyPreimage()
+	assert.True(t, ok)
+	assert.Equal(t, []byte("account"), got)
+	assert.False(t, it.Next())
+
+	// the preimages are kept apart from the nodes
+	root, _, err := zkTrie.Commit()
+	assert.NoError(t, err)
+	assert.NoError(t, db.ForEach(func(k, v []byte) error {
+		assert.NotEqual(t, []byte("account"), v)
+		return nil
+	}))
+	_, err = Prune(db, []*zkt.Hash{root}, false)
+	assert.NoError(t, err)
+	_, ok = zkTrie.Tree().KeyPreimage(zkt.NewHashFromBigInt(k))
+	assert.True(t, ok)
+}
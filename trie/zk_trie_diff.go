@@ -0,0 +1,213 @@
+package trie
+
+import (
+	zkt "github.com/scroll-tech/zktrie/types"
+)
+
+// DiffType is the kind of change of a leaf between two tries
+type DiffType int
+
+const (
+	// DiffAdded is a leaf only existed in the new trie
+	DiffAdded DiffType = iota
+	// DiffRemoved is a leaf only existed in the old trie
+	DiffRemoved
+	// DiffModified is a leaf existed in both tries with different values
+	DiffModified
+)
+
+func (t DiffType) String() string {
+	switch t {
+	case DiffAdded:
+		return "added"
+	case DiffRemoved:
+		return "removed"
+	case DiffModified:
+		return "modified"
+	default:
+		return "unknown"
+	}
+}
+
+// DiffEntry is a changed leaf yielded by DiffIterator
+type DiffEntry struct {
+	Type    DiffType
+	NodeKey *zkt.Hash
+	Old     *Node // the leaf in the old trie, nil for DiffAdded
+	New     *Node // the leaf in the new trie, nil for DiffRemoved
+}
+
+// OldValue returns the value preimage of the leaf in the old trie
+func (e *DiffEntry) OldValue() []zkt.Byte32 {
+	if e.Old == nil {
+		return nil
+	}
+	return e.Old.ValuePreimage
+}
+
+// NewValue returns the value preimage of the leaf in the new trie
+func (e *DiffEntry) NewValue() []zkt.Byte32 {
+	if e.New == nil {
+		return nil
+	}
+	return e.New.ValuePreimage
+}
+
+// diffFrame is a pair of sub-tries at the same path waiting to be compared
+type diffFrame struct {
+	oldHash *zkt.Hash
+	newHash *zkt.Hash
+	path    []bool
+}
+
+// DiffIterator is a pull-style iterator which yields the leaves changed
+// between two tries in path order of their node keys. Both tries are walked
+// together by path, and the sub-tries with identical hashes are skipped
+// without being resolved, so the cost is proportional to the size of the
+// changes rather than the size of the tries.
+//
+// When a node is missing in the db, Next returns false and Error returns a
+// *MissingNodeError.
+type DiffIterator struct {
+	mt      *ZkTrieImpl
+	stack   []*diffFrame
+	pending []*DiffEntry
+	entry   *DiffEntry
+	err     error
+}
+
+// Diff creates an iterator over the changes from the trie with oldRoot to the
+// trie with newRoot, both of them must be resolvable from the db of the MT
+func (mt *ZkTrieImpl) Diff(oldRoot, newRoot *zkt.Hash) *DiffIterator {
+	return &DiffIterator{
+		mt:    mt,
+		stack: []*diffFrame{{oldHash: oldRoot, newHash: newRoot}},
+	}
+}
+
+// Next moves the iterator to the next changed leaf, it returns false when the
+// iteration is finished or an error has been encountered
+func (it *DiffIterator) Next() bool {
+	for {
+		if len(it.pending) > 0 {
+			it.entry, it.pending = it.pending[0], it.pending[1:]
+			return true
+		}
+		it.entry = nil
+		if it.err != nil || len(it.stack) == 0 {
+			return false
+		}
+
+		f := it.stack[len(it.stack)-1]
+		it.stack = it.stack[:len(it.stack)-1]
+		if *f.oldHash == *f.newHash {
+			continue
+		}
+		if len(f.path) >= it.mt.maxLevels {
+			it.err = ErrReachedMaxLevel
+			return false
+		}
+
+		oldNode, err := it.resolve(f.oldHash, f.path)
+		if err != nil {
+			it.err = err
+			return false
+		}
+		newNode, err := it.resolve(f.newHash, f.path)
+		if err != nil {
+			it.err = err
+			return false
+		}
+
+		if oldNode.Type == NodeTypeParent || newNode.Type == NodeTypeParent {
+			oldL, oldR, err := it.children(oldNode, f.oldHash, len(f.path))
+			if err != nil {
+				it.err = err
+				return false
+			}
+			newL, newR, err := it.children(newNode, f.newHash, len(f.path))
+			if err != nil {
+				it.err = err
+				return false
+			}
+			// push the right side first so the left side is visited first
+			it.stack = append(it.stack,
+				&diffFrame{oldHash: oldR, newHash: newR, path: appendPath(f.path, true)},
+				&diffFrame{oldHash: oldL, newHash: newL, path: appendPath(f.path, false)},
+			)
+			continue
+		}
+
+		if err := it.diffLeaves(oldNode, newNode); err != nil {
+			it.err = err
+			return false
+		}
+	}
+}
+
+func (it *DiffIterator) resolve(nodeHash *zkt.Hash, path []bool) (*Node, error) {
+	if *nodeHash == zkt.HashZero {
+		return NewEmptyNode(), nil
+	}
+	n, err := it.mt.GetNode(nodeHash)
+	if err == ErrKeyNotFound {
+		return nil, &MissingNodeError{NodeHash: nodeHash, Path: path, Err: err}
+	}
+	return n, err
+}
+
+// children returns the children of the node at depth. A leaf or an empty
+// node is treated as a parent with the node itself at the side of its path
+// and an empty node at the other side
+func (it *DiffIterator) children(n *Node, nodeHash *zkt.Hash, depth int) (*zkt.Hash, *zkt.Hash, error) {
+	switch n.Type {
+	case NodeTypeParent:
+		return n.ChildL, n.ChildR, nil
+	case NodeTypeLeaf:
+		if zkt.TestBit(n.NodeKey[:], uint(depth)) {
+			return &zkt.HashZero, nodeHash, nil
+		}
+		return nodeHash, &zkt.HashZero, nil
+	case NodeTypeEmpty:
+		return &zkt.HashZero, &zkt.HashZero, nil
+	default:
+		return nil, nil, ErrInvalidNodeFound
+	}
+}
+
+// diffLeaves compares two different nodes which are leaf or empty
+func (it *DiffIterator) diffLeaves(oldNode, newNode *Node) error {
+	if (oldNode.Type != NodeTypeLeaf && oldNode.Type != NodeTypeEmpty) ||
+		(newNode.Type != NodeTypeLeaf && newNode.Type != NodeTypeEmpty) {
+		return ErrInvalidNodeFound
+	}
+
+	switch {
+	case oldNode.Type == NodeTypeEmpty:
+		it.pending = append(it.pending, &DiffEntry{Type: DiffAdded, NodeKey: newNode.NodeKey, New: newNode})
+	case newNode.Type == NodeTypeEmpty:
+		it.pending = append(it.pending, &DiffEntry{Type: DiffRemoved, NodeKey: oldNode.NodeKey, Old: oldNode})
+	case *oldNode.NodeKey == *newNode.NodeKey:
+		it.pending = append(it.pending, &DiffEntry{Type: DiffModified, NodeKey: newNode.NodeKey, Old: oldNode, New: newNode})
+	default:
+		removed := &DiffEntry{Type: DiffRemoved, NodeKey: oldNode.NodeKey, Old: oldNode}
+		added := &DiffEntry{Type: DiffAdded, NodeKey: newNode.NodeKey, New: newNode}
+		if comparePath(it.mt.maxLevels, oldNode.NodeKey, newNode.NodeKey) < 0 {
+			it.pending = append(it.pending, removed, added)
+		} else {
+			it.pending = append(it.pending, added, removed)
+		}
+	}
+	return nil
+}
+
+// Entry returns the current changed leaf
+func (it *DiffIterator) Entry() *DiffEntry {
+	return it.entry
+}
+
+// Error returns the error encountered by iteration, or nil if the iteration
+// is finished normally
+func (it *DiffIterator) Error() error {
+	return it.err
+}
@@ -0,0 +1,126 @@
+package trie
+
+import (
+	"errors"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	zkt "github.com/scroll-tech/zktrie/types"
+)
+
+func collectLeafMap(t *testing.T, mt *ZkTrieImpl, root *zkt.Hash) map[zkt.Hash]*Node {
+	ret := make(map[zkt.Hash]*Node)
+	it := mt.NewLeafIterator(root)
+	for it.Next() {
+		ret[*it.Key()] = it.Node()
+	}
+	assert.NoError(t, it.Error())
+	return ret
+}
+
+func TestZkTrieImpl_Diff(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	randKey := func() *zkt.Hash {
+		var k [32]byte
+		r.Read(k[1:])
+		return zkt.NewHashFromBytes(k[:])
+	}
+
+	mt, err := NewZkTrieImpl(NewZkTrieMemoryDb(), 248)
+	assert.NoError(t, err)
+	var keys []*zkt.Hash
+	for i := 0; i < 200; i++ {
+		k := randKey()
+		keys = append(keys, k)
+		assert.NoError(t, mt.TryUpdate(k, 1, []zkt.Byte32{{byte(i)}}))
+	}
+	oldRoot, _, err := mt.Commit()
+	assert.NoError(t, err)
+
+	t.Run("Identical roots", func(t *testing.T) {
+		it := mt.Diff(oldRoot, oldRoot)
+		assert.False(t, it.Next())
+		assert.NoError(t, it.Error())
+	})
+
+	for i := 0; i < 30; i++ {
+		assert.NoError(t, mt.TryUpdate(keys[i], 1, []zkt.Byte32{{byte(i), 1}}))
+	}
+	for i := 30; i < 60; i++ {
+		assert.NoError(t, mt.TryDelete(keys[i]))
+	}
+	for i := 0; i < 30; i++ {
+		assert.NoError(t, mt.TryUpdate(randKey(), 1, []zkt.Byte32{{byte(i), 2}}))
+	}
+	// updated with the same value
+	assert.NoError(t, mt.TryUpdate(keys[60], 1, []zkt.Byte32{{60}}))
+	newRoot, _, err := mt.Commit()
+	assert.NoError(t, err)
+
+	oldLeaves := collectLeafMap(t, mt, oldRoot)
+	newLeaves := collectLeafMap(t, mt, newRoot)
+
+	t.Run("Changes", func(t *testing.T) {
+		counts := make(map[DiffType]int)
+		var last *zkt.Hash
+		it := mt.Diff(oldRoot, newRoot)
+		for it.Next() {
+			e := it.Entry()
+			if last != nil {
+				assert.Equal(t, -1, comparePath(mt.maxLevels, last, e.NodeKey))
+			}
+			last = e.NodeKey
+			counts[e.Type]++
+
+			oldLeaf, inOld := oldLeaves[*e.NodeKey]
+			newLeaf, inNew := newLeaves[*e.NodeKey]
+			switch e.Type {
+			case DiffAdded:
+				assert.False(t, inOld)
+				assert.Nil(t, e.Old)
+				assert.Equal(t, newLeaf.ValuePreimage, e.NewValue())
+			case DiffRemoved:
+				assert.False(t, inNew)
+				assert.Nil(t, e.New)
+				assert.Equal(t, oldLeaf.ValuePreimage, e.OldValue())
+			case DiffModified:
+				assert.Equal(t, oldLeaf.ValuePreimage, e.OldValue())
+				assert.Equal(t, newLeaf.ValuePreimage, e.NewValue())
+				assert.NotEqual(t, e.OldValue(), e.NewValue())
+			}
+		}
+		assert.NoError(t, it.Error())
+		assert.Equal(t, map[DiffType]int{DiffAdded: 30, DiffRemoved: 30, DiffModified: 30}, counts)
+	})
+
+	t.Run("Reversed", func(t *testing.T) {
+		counts := make(map[DiffType]int)
+		it := mt.Diff(newRoot, oldRoot)
+		for it.Next() {
+			counts[it.Entry().Type]++
+		}
+		assert.NoError(t, it.Error())
+		assert.Equal(t, map[DiffType]int{DiffAdded: 30, DiffRemoved: 30, DiffModified: 30}, counts)
+	})
+
+	t.Run("From empty", func(t *testing.T) {
+		var added []*zkt.Hash
+		it := mt.Diff(&zkt.HashZero, oldRoot)
+		for it.Next() {
+			assert.Equal(t, DiffAdded, it.Entry().Type)
+			added = append(added, it.Entry().NodeKey)
+		}
+		assert.NoError(t, it.Error())
+		assert.Equal(t, collectLeaves(mt.NewLeafIterator(oldRoot)), added)
+	})
+
+	t.Run("Missing node", func(t *testing.T) {
+		it := mt.Diff(oldRoot, &zkt.Hash{1})
+		assert.False(t, it.Next())
+		var missing *MissingNodeError
+		assert.True(t, errors.As(it.Error(), &missing))
+		assert.Equal(t, &zkt.Hash{1}, missing.NodeHash)
+	})
+}
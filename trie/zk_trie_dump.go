@@ -0,0 +1,190 @@
+package trie
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	zkt "github.com/scroll-tech/zktrie/types"
+)
+
+// A leaf dump is a stream encoded as
+//
+//	magic | version (1 byte) | root hash (32 bytes) | leaf record ... | 0 | leaf count (uvarint)
+//
+// and each leaf record is
+//
+//	uvarint length | leaf | uvarint length | key preimage
+//
+// where the leaf is the encoded leaf node (Node.Value), which contains the
+// node key, the compressed flags and the value preimage, and the key preimage
+// is the original key recorded in the db (empty if it is not known). The
+// leaves are written in path order, the terminator and the leaf count are used
+// to detect a truncated dump.
+var dumpMagic = []byte("ZKTRIEDUMP")
+
+const (
+	dumpVersion = 1
+	// dumpMaxRecordSize is the size limit of a leaf record
+	dumpMaxRecordSize = 1 + zkt.HashByteLen + 4 + 255*32 + 1 + 32
+	// dumpMaxKeyPreimageSize is the size limit of a key preimage, a key may
+	// be longer than the 32 bytes used to derive its node key
+	dumpMaxKeyPreimageSize = 1024
+)
+
+// ErrInvalidDump is returned when importing a malformed leaf dump
+var ErrInvalidDump = errors.New("invalid leaf dump")
+
+// DumpLeafs writes all the leaves of the trie with rootHash into w, if
+// rootHash is nil the current root of the MT is used. It fails if a recorded
+// key preimage is longer than 1024 bytes, which could not be imported
+func (mt *ZkTrieImpl) DumpLeafs(w io.Writer, rootHash *zkt.Hash) error {
+	if rootHash == nil {
+		rootHash = mt.Root()
+	}
+
+	bw := bufio.NewWriter(w)
+	header := append(append([]byte{}, dumpMagic...), dumpVersion)
+	header = append(header, rootHash.Bytes()...)
+	if _, err := bw.Write(header); err != nil {
+		return err
+	}
+
+	var count uint64
+	var lenBuf [binary.MaxVarintLen64]byte
+	it := mt.NewLeafIterator(rootHash)
+	for it.Next() {
+		rec := it.Node().Value()
+		if _, err := bw.Write(lenBuf[:binary.PutUvarint(lenBuf[:], uint64(len(rec)))]); err != nil {
+			return err
+		}
+		if _, err := bw.Write(rec); err != nil {
+			return err
+		}
+		preimage, _ := it.KeyPreimage()
+		if len(preimage) > dumpMaxKeyPreimageSize {
+			return fmt.Errorf("key preimage of %s is too long: %d bytes", it.Node().NodeKey.Hex(), len(preimage))
+		}
+		if _, err := bw.Write(lenBuf[:binary.PutUvarint(lenBuf[:], uint64(len(preimage)))]); err != nil {
+			return err
+		}
+		if _, err := bw.Write(preimage); err != nil {
+			return err
+		}
+		count++
+	}
+	if err := it.Error(); err != nil {
+		return err
+	}
+
+	if err := bw.WriteByte(0); err != nil {
+		return err
+	}
+	if _, err := bw.Write(lenBuf[:binary.PutUvarint(lenBuf[:], count)]); err != nil {
+		return err
+	}
+	return bw.Flush()
+}
+
+// ImportDumpedLeafs inserts all the leaves from a dump written by DumpLeafs
+// into the MT and commits it, the resulted root must be identical to the root
+// recorded in the dump. The key preimages in the dump are verified and
+// recorded in the db. It is expected to be called on an empty MT with a
+// fresh database
+func (mt *ZkTrieImpl) ImportDumpedLeafs(r io.Reader) error {
+	// verify that the ZkTrieImpl is writable
+	if !mt.writable {
+		return ErrNotWritable
+	}
+
+	br := bufio.NewReader(r)
+	header := make([]byte, len(dumpMagic)+1+zkt.HashByteLen)
+	if _, err := io.ReadFull(br, header); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidDump, err)
+	}
+	if !bytes.Equal(header[:len(dumpMagic)], dumpMagic) || header[len(dumpMagic)] != dumpVersion {
+		return ErrInvalidDump
+	}
+	expectedRoot := zkt.NewHashFromBytes(header[len(dumpMagic)+1:])
+
+	type keyPreimage struct {
+		nodeKey  *zkt.Hash
+		preimage []byte
+	}
+	var count uint64
+	var preimages []keyPreimage
+	for {
+		size, err := binary.ReadUvarint(br)
+		if err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidDump, err)
+		}
+		if size == 0 {
+			break
+		}
+		if size > dumpMaxRecordSize {
+			return ErrInvalidDump
+		}
+		rec := make([]byte, size)
+		if _, err := io.ReadFull(br, rec); err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidDump, err)
+		}
+		n, err := NewNodeFromBytes(rec)
+		if err != nil || n.Type != NodeTypeLeaf {
+			return ErrInvalidDump
+		}
+		preimage, err := readKeyPreimage(br)
+		if err != nil {
+			return err
+		}
+		if len(preimage) > 0 {
+			k, err := zkt.ToSecureKeyWithHasher(mt.hasher, preimage)
+			if err != nil {
+				return err
+			}
+			if *zkt.NewHashFromBigInt(k) != *n.NodeKey {
+				return fmt.Errorf("%w: key preimage mismatches node key %s", ErrInvalidDump, n.NodeKey.Hex())
+			}
+			preimages = append(preimages, keyPreimage{nodeKey: n.NodeKey, preimage: preimage})
+		}
+		if err := mt.TryUpdate(n.NodeKey, n.CompressedFlags, n.ValuePreimage); err != nil {
+			return err
+		}
+		count++
+	}
+
+	dumped, err := binary.ReadUvarint(br)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidDump, err)
+	}
+	if dumped != count {
+		return fmt.Errorf("%w: %d leaves imported, expected %d", ErrInvalidDump, count, dumped)
+	}
+
+	if !bytes.Equal(mt.rootHash[:], expectedRoot[:]) {
+		return fmt.Errorf("%w: root %s mismatches the dumped root %s", ErrInvalidDump, mt.rootHash.Hex(), expectedRoot.Hex())
+	}
+	for _, p := range preimages {
+		mt.db.UpdatePreimage(p.preimage, p.nodeKey.BigInt())
+	}
+	_, _, err = mt.Commit()
+	return err
+}
+
+// readKeyPreimage reads the length-prefixed key preimage of a leaf record
+func readKeyPreimage(br *bufio.Reader) ([]byte, error) {
+	size, err := binary.ReadUvarint(br)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidDump, err)
+	}
+	if size > dumpMaxKeyPreimageSize {
+		return nil, ErrInvalidDump
+	}
+	preimage := make([]byte, size)
+	if _, err := io.ReadFull(br, preimage); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidDump, err)
+	}
+	return preimage, nil
+}
@@ -0,0 +1,201 @@
+package trie
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"testing"
+
+	zkt "github.com/scroll-tech/zktrie/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDumpLeafs(t *testing.T) {
+	mt, err := NewZkTrieImpl(NewZkTrieMemoryDb(), NodeKeyValidBytes*8)
+	assert.NoError(t, err)
+	for i := 0; i < 32; i++ {
+		k := zkt.NewHashFromBytes([]byte{byte(i), byte(i * 3)})
+		preimages := []zkt.Byte32{{byte(i)}}
+		if i%2 == 0 {
+			preimages = append(preimages, zkt.Byte32{byte(i), 2})
+		}
+		assert.NoError(t, mt.TryUpdate(k, uint32(i%2), preimages))
+	}
+	// a deleted key is not dumped
+	assert.NoError(t, mt.TryDelete(zkt.NewHashFromBytes([]byte{0, 0})))
+	root, _, err := mt.Commit()
+	assert.NoError(t, err)
+
+	var dump bytes.Buffer
+	assert.NoError(t, mt.DumpLeafs(&dump, nil))
+
+	db := NewZkTrieMemoryDb()
+	imported, err := NewZkTrieImpl(db, NodeKeyValidBytes*8)
+	assert.NoError(t, err)
+	assert.NoError(t, imported.ImportDumpedLeafs(bytes.NewReader(dump.Bytes())))
+	assert.Equal(t, root, imported.Root())
+
+	// the trie can be opened from the new db
+	reopened, err := NewZkTrieImplWithRoot(db, root, NodeKeyValidBytes*8)
+	assert.NoError(t, err)
+	for i := 1; i < 32; i++ {
+		node, err := reopened.GetLeafNode(zkt.NewHashFromBytes([]byte{byte(i), byte(i * 3)}))
+		assert.NoError(t, err)
+		assert.Equal(t, zkt.Byte32{byte(i)}, node.ValuePreimage[0])
+		assert.Equal(t, uint32(i%2), node.CompressedFlags)
+	}
+
+	// dump an empty trie
+	var emptyDump bytes.Buffer
+	assert.NoError(t, mt.DumpLeafs(&emptyDump, &zkt.HashZero))
+	empty, err := NewZkTrieImpl(NewZkTrieMemoryDb(), NodeKeyValidBytes*8)
+	assert.NoError(t, err)
+	assert.NoError(t, empty.ImportDumpedLeafs(&emptyDump))
+	assert.Equal(t, &zkt.HashZero, empty.Root())
+}
+
+func TestImportDumpedLeafsInvalid(t *testing.T) {
+	mt, err := NewZkTrieImpl(NewZkTrieMemoryDb(), NodeKeyValidBytes*8)
+	assert.NoError(t, err)
+	for i := 0; i < 8; i++ {
+		assert.NoError(t, mt.TryUpdate(zkt.NewHashFromBytes([]byte{byte(i + 1)}), 0, []zkt.Byte32{{byte(i)}}))
+	}
+	var dump bytes.Buffer
+	assert.NoError(t, mt.DumpLeafs(&dump, nil))
+	data := dump.Bytes()
+
+	importDump := func(data []byte) error {
+		imported, err := NewZkTrieImpl(NewZkTrieMemoryDb(), NodeKeyValidBytes*8)
+		assert.NoError(t, err)
+		return imported.ImportDumpedLeafs(bytes.NewReader(data))
+	}
+
+	// truncated
+	for _, size := range []int{0, 5, len(dumpMagic) + 10, len(data) / 2, len(data) - 1} {
+		assert.True(t, errors.Is(importDump(data[:size]), ErrInvalidDump), "size %d", size)
+	}
+
+	// bad magic
+	bad := append([]byte{}, data...)
+	bad[0] ^= 1
+	assert.True(t, errors.Is(importDump(bad), ErrInvalidDump))
+
+	// tampered root
+	bad = append([]byte{}, data...)
+	bad[len(dumpMagic)+1] ^= 1
+	assert.True(t, errors.Is(importDump(bad), ErrInvalidDump))
+
+	// tampered leaf count
+	bad = append([]byte{}, data...)
+	bad[len(bad)-1]++
+	assert.True(t, errors.Is(importDump(bad), ErrInvalidDump))
+
+	assert.NoError(t, importDump(data))
+}
+
+func TestDumpLeafs_KeyPreimage(t *testing.T) {
+	zkTrie, err := NewZkTrie(zkt.Byte32{}, NewZkTrieMemoryDb())
+	assert.NoError(t, err)
+	for i := 0; i < 8; i++ {
+		key := make([]byte, 32)
+		key[31] = byte(i + 1)
+		assert.NoError(t, zkTrie.TryUpdate(key, 1, []zkt.Byte32{{byte(i)}}))
+	}
+	// a key without preimage
+	assert.NoError(t, zkTrie.Tree().TryUpdate(zkt.NewHashFromBytes([]byte{3}), 1, []zkt.Byte32{{1}}))
+	_, _, err = zkTrie.Commit()
+	assert.NoError(t, err)
+
+	var dump bytes.Buffer
+	assert.NoError(t, zkTrie.Tree().DumpLeafs(&dump, nil))
+
+	imported, err := NewZkTrieImpl(NewZkTrieMemoryDb(), NodeKeyValidBytes*8)
+	assert.NoError(t, err)
+	assert.NoError(t, imported.ImportDumpedLeafs(bytes.NewReader(dump.Bytes())))
+	for i := 0; i < 8; i++ {
+		key := make([]byte, 32)
+		key[31] = byte(i + 1)
+		k, err := zkt.ToSecureKey(key)
+		assert.NoError(t, err)
+		preimage, ok := imported.KeyPreimage(zkt.NewHashFromBigInt(k))
+		assert.True(t, ok)
+		assert.Equal(t, key, preimage)
+	}
+	_, ok := imported.KeyPreimage(zkt.NewHashFromBytes([]byte{3}))
+	assert.False(t, ok)
+
+	// tampered key preimage, which is the last byte of the first record
+	data := dump.Bytes()
+	offset := len(dumpMagic) + 1 + zkt.HashByteLen
+	size, n := binary.Uvarint(data[offset:])
+	offset += n + int(size)
+	size, n = binary.Uvarint(data[offset:])
+	assert.Equal(t, uint64(32), size)
+	data[offset+n+int(size)-1] ^= 1
+	imported, err = NewZkTrieImpl(NewZkTrieMemoryDb(), NodeKeyValidBytes*8)
+	assert.NoError(t, err)
+	assert.ErrorIs(t, imported.ImportDumpedLeafs(bytes.NewReader(data)), ErrInvalidDump)
+}
+
+func TestDumpLeafs_AddressPreimage(t *testing.T) {
+	db := NewZkTrieMemoryDb()
+	zkTrie, err := NewZkTrie(zkt.Byte32{}, db)
+	assert.NoError(t, err)
+	addr := make([]byte, 20)
+	for i := range addr {
+		addr[i] = byte(i + 1)
+	}
+	assert.NoError(t, zkTrie.TryUpdate(addr, 1, []zkt.Byte32{{1}}))
+	_, _, err = zkTrie.Commit()
+	assert.NoError(t, err)
+
+	var dump bytes.Buffer
+	assert.NoError(t, zkTrie.Tree().DumpLeafs(&dump, nil))
+
+	imported, err := NewZkTrieImpl(NewZkTrieMemoryDb(), NodeKeyValidBytes*8)
+	assert.NoError(t, err)
+	assert.NoError(t, imported.ImportDumpedLeafs(bytes.NewReader(dump.Bytes())))
+	k, err := zkt.ToSecureKey(addr)
+	assert.NoError(t, err)
+	preimage, ok := imported.KeyPreimage(zkt.NewHashFromBigInt(k))
+	assert.True(t, ok)
+	assert.Equal(t, addr, preimage)
+
+	// dumped again with the same bytes
+	var redump bytes.Buffer
+	assert.NoError(t, imported.DumpLeafs(&redump, nil))
+	assert.Equal(t, dump.Bytes(), redump.Bytes())
+}
+
+func TestDumpLeafs_LongKeyPreimage(t *testing.T) {
+	zkTrie, err := NewZkTrie(zkt.Byte32{}, NewZkTrieMemoryDb())
+	assert.NoError(t, err)
+	// only the first 32 bytes derive the node key
+	key := make([]byte, 40)
+	for i := range key {
+		key[i] = byte(i + 1)
+	}
+	assert.NoError(t, zkTrie.TryUpdate(key, 1, []zkt.Byte32{{1}}))
+	_, _, err = zkTrie.Commit()
+	assert.NoError(t, err)
+
+	var dump bytes.Buffer
+	assert.NoError(t, zkTrie.Tree().DumpLeafs(&dump, nil))
+	imported, err := NewZkTrieImpl(NewZkTrieMemoryDb(), NodeKeyValidBytes*8)
+	assert.NoError(t, err)
+	assert.NoError(t, imported.ImportDumpedLeafs(bytes.NewReader(dump.Bytes())))
+	k, err := zkt.ToSecureKey(key)
+	assert.NoError(t, err)
+	preimage, ok := imported.KeyPreimage(zkt.NewHashFromBigInt(k))
+	assert.True(t, ok)
+	assert.Equal(t, key, preimage)
+
+	// a preimage which could not be imported is not dumped
+	zkTrie, err = NewZkTrie(zkt.Byte32{}, NewZkTrieMemoryDb())
+	assert.NoError(t, err)
+	key = make([]byte, dumpMaxKeyPreimageSize+1)
+	key[0] = 1
+	assert.NoError(t, zkTrie.TryUpdate(key, 1, []zkt.Byte32{{1}}))
+	assert.Error(t, zkTrie.Tree().DumpLeafs(io.Discard, nil))
+}
@@ -0,0 +1,674 @@
+package trie
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	zkt "github.com/scroll-tech/zktrie/types"
+)
+
+// The file database stores k/v in append-only log segments under a
+// directory, each record in a segment is encoded as
+//
+//	crc32 (4 bytes) | entry
+//
+// and an entry is encoded as
+//
+//	kind (1 byte) | key length (4 bytes) | value length (4 bytes) | key | value
+//
+// where all integers are big-endian and the crc32 (IEEE) covers the entry.
+// The value of a batch entry is the concatenation of the entries in the batch
+// so a batch is persisted or dropped as a whole. A later entry overrides the
+// earlier ones of the same key. The index from key to the latest value is kept
+// in memory and rebuilt by scanning the segments when the db is opened, an
+// incomplete or corrupted record at the tail of the last segment (e.g. left by
+// a crash) is truncated. The temporary segments left by an interrupted
+// compaction are removed.
+//
+// The key preimages are kept in another file database under the preimages
+// sub-directory, keyed by the hash, so they are never mixed with the nodes.
+const (
+	fileDbSegmentSuffix = ".log"
+	fileDbTmpSuffix     = ".tmp"
+	fileDbPreimageDir   = "preimages"
+	fileDbEntryHeader   = 9
+	fileDbRecordHeader  = 4 + fileDbEntryHeader
+
+	// DefaultFileDbSegmentSize is the default size limit of a log segment
+	DefaultFileDbSegmentSize = 64 * 1024 * 1024
+)
+
+const (
+	entryKindPut    byte = 1
+	entryKindDelete byte = 2
+	entryKindBatch  byte = 3
+)
+
+var (
+	// ErrFileDbClosed is returned when accessing a closed file database
+	ErrFileDbClosed = errors.New("file database is closed")
+	// ErrFileDbCorrupted is returned when a segment other than the last one
+	// contains invalid records
+	ErrFileDbCorrupted = errors.New("file database is corrupted")
+)
+
+// FileDbOptions is the options for opening a file database
+type FileDbOptions struct {
+	// SegmentSize is the size limit of a log segment, a new segment is
+	// created when the current one exceeds it. DefaultFileDbSegmentSize is
+	// used when it is 0
+	SegmentSize int64
+	// SyncWrites calls fsync after every write, otherwise the writes are
+	// only guaranteed to be durable after Sync or Close
+	SyncWrites bool
+}
+
+type valuePos struct {
+	segment uint32
+	offset  int64 // offset of the value in segment
+	size    uint32
+}
+
+// FileDatabase is a ZktrieDatabase persisted in log segments on disk
+type FileDatabase struct {
+	dir      string
+	opts     FileDbOptions
+	index    map[string]valuePos
+	segments map[uint32]*os.File
+	active   uint32 // id of the segment being appended
+	size     int64  // size of the active segment
+	closed   bool
+	lock     sync.RWMutex
+
+	preimages *FileDatabase // nil for the preimage store itself
+}
+
+// NewZkTrieFileDb opens the file database in dir, creating it if it is not
+// existed. opts can be nil to use the default options
+func NewZkTrieFileDb(dir string, opts *FileDbOptions) (*FileDatabase, error) {
+	db, err := openFileDb(dir, opts)
+	if err != nil {
+		return nil, err
+	}
+	db.preimages, err = openFileDb(filepath.Join(dir, fileDbPreimageDir), opts)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+// openFileDb opens the log segments in dir
+func openFileDb(dir string, opts *FileDbOptions) (*FileDatabase, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	db := &FileDatabase{
+		dir:      dir,
+		index:    make(map[string]valuePos),
+		segments: make(map[uint32]*os.File),
+	}
+	if opts != nil {
+		db.opts = *opts
+	}
+	if db.opts.SegmentSize <= 0 {
+		db.opts.SegmentSize = DefaultFileDbSegmentSize
+	}
+
+	if err := db.removeTmpSegments(); err != nil {
+		return nil, err
+	}
+	ids, err := db.listSegments()
+	if err != nil {
+		return nil, err
+	}
+	created := len(ids) == 0
+	if created {
+		ids = []uint32{0}
+	}
+	for i, id := range ids {
+		f, err := os.OpenFile(db.segmentPath(id), os.O_RDWR|os.O_CREATE, 0644)
+		if err != nil {
+			db.closeSegments()
+			return nil, err
+		}
+		db.segments[id] = f
+		if created {
+			if err := db.syncDir(); err != nil {
+				db.closeSegments()
+				return nil, err
+			}
+		}
+
+		info, err := f.Stat()
+		if err != nil {
+			db.closeSegments()
+			return nil, err
+		}
+		end, err := db.loadSegment(id, f, info.Size())
+		if err != nil {
+			db.closeSegments()
+			return nil, err
+		}
+		if end != info.Size() {
+			if i != len(ids)-1 {
+				db.closeSegments()
+				return nil, fmt.Errorf("%w: segment %d at offset %d", ErrFileDbCorrupted, id, end)
+			}
+			// drop the incomplete tail of the last segment
+			if err := f.Truncate(end); err != nil {
+				db.closeSegments()
+				return nil, err
+			}
+			if err := f.Sync(); err != nil {
+				db.closeSegments()
+				return nil, err
+			}
+		}
+		db.active, db.size = id, end
+	}
+
+	return db, nil
+}
+
+func (db *FileDatabase) segmentPath(id uint32) string {
+	return filepath.Join(db.dir, fmt.Sprintf("%08d%s", id, fileDbSegmentSuffix))
+}
+
+func (db *FileDatabase) tmpSegmentPath(id uint32) string {
+	return db.segmentPath(id) + fileDbTmpSuffix
+}
+
+// syncDir flushes the directory entries, so the segments being created,
+// renamed or removed are durable
+func (db *FileDatabase) syncDir() error {
+	d, err := os.Open(db.dir)
+	if err != nil {
+		return err
+	}
+	err = d.Sync()
+	if closeErr := d.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// removeTmpSegments removes the temporary segments left by an interrupted
+// compaction, they are never renamed into segments so nothing is lost
+func (db *FileDatabase) removeTmpSegments() error {
+	tmps, err := filepath.Glob(filepath.Join(db.dir, "*"+fileDbSegmentSuffix+fileDbTmpSuffix))
+	if err != nil {
+		return err
+	}
+	for _, tmp := range tmps {
+		if err := os.Remove(tmp); err != nil {
+			return err
+		}
+	}
+	if len(tmps) == 0 {
+		return nil
+	}
+	return db.syncDir()
+}
+
+func (db *FileDatabase) listSegments() ([]uint32, error) {
+	entries, err := os.ReadDir(db.dir)
+	if err != nil {
+		return nil, err
+	}
+	var ids []uint32
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, fileDbSegmentSuffix) {
+			continue
+		}
+		id, err := strconv.ParseUint(strings.TrimSuffix(name, fileDbSegmentSuffix), 10, 32)
+		if err != nil {
+			continue
+		}
+		ids = append(ids, uint32(id))
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids, nil
+}
+
+// loadSegment scans all the valid records in the segment into the index,
+// it returns the offset of the end of the last valid record
+func (db *FileDatabase) loadSegment(id uint32, f *os.File, size int64) (int64, error) {
+	var offset int64
+	header := make([]byte, fileDbRecordHeader)
+	for offset+fileDbRecordHeader <= size {
+		if _, err := f.ReadAt(header, offset); err != nil {
+			return 0, err
+		}
+		recordLen := fileDbRecordHeader + int64(binary.BigEndian.Uint32(header[5:9])) + int64(binary.BigEndian.Uint32(header[9:13]))
+		if offset+recordLen > size {
+			// incomplete record
+			break
+		}
+		rec := make([]byte, recordLen)
+		if _, err := f.ReadAt(rec, offset); err != nil {
+			return 0, err
+		}
+		if crc32.ChecksumIEEE(rec[4:]) != binary.BigEndian.Uint32(rec[:4]) || !db.applyRecord(id, offset, rec) {
+			break
+		}
+		offset += recordLen
+	}
+	return offset, nil
+}
+
+// decodeEntry decodes the entry at the beginning of buf, it returns the kind,
+// key, the offset of value in buf, the value length and the total length of the entry
+func decodeEntry(buf []byte) (byte, []byte, int, int, int, bool) {
+	if len(buf) < fileDbEntryHeader {
+		return 0, nil, 0, 0, 0, false
+	}
+	keyLen := int64(binary.BigEndian.Uint32(buf[1:5]))
+	valLen := int64(binary.BigEndian.Uint32(buf[5:9]))
+	if fileDbEntryHeader+keyLen+valLen > int64(len(buf)) {
+		return 0, nil, 0, 0, 0, false
+	}
+	valOff := fileDbEntryHeader + int(keyLen)
+	return buf[0], buf[fileDbEntryHeader:valOff], valOff, int(valLen), valOff + int(valLen), true
+}
+
+func appendEntry(buf []byte, kind byte, k, v []byte) []byte {
+	var header [fileDbEntryHeader]byte
+	header[0] = kind
+	binary.BigEndian.PutUint32(header[1:5], uint32(len(k)))
+	binary.BigEndian.PutUint32(header[5:9], uint32(len(v)))
+	buf = append(buf, header[:]...)
+	buf = append(buf, k...)
+	return append(buf, v...)
+}
+
+func encodeRecord(kind byte, k, v []byte) []byte {
+	rec := appendEntry(make([]byte, 4, fileDbRecordHeader+len(k)+len(v)), kind, k, v)
+	binary.BigEndian.PutUint32(rec[:4], crc32.ChecksumIEEE(rec[4:]))
+	return rec
+}
+
+// applyRecord updates the index with the record written at offset of the
+// segment, it returns false if the record is malformed and nothing is applied
+func (db *FileDatabase) applyRecord(id uint32, offset int64, rec []byte) bool {
+	kind, _, valOff, valLen, _, ok := decodeEntry(rec[4:])
+	if !ok {
+		return false
+	}
+	if kind != entryKindBatch {
+		return db.applyEntries(id, offset+4, rec[4:])
+	}
+	base := offset + 4 + int64(valOff)
+	return db.applyEntries(id, base, rec[4+valOff:4+valOff+valLen])
+}
+
+// applyEntries updates the index with the entries in buf which is located at
+// offset of the segment, nested batch is not allowed
+func (db *FileDatabase) applyEntries(id uint32, offset int64, buf []byte) bool {
+	for pos := 0; pos < len(buf); {
+		kind, _, _, _, next, ok := decodeEntry(buf[pos:])
+		if !ok || (kind != entryKindPut && kind != entryKindDelete) {
+			return false
+		}
+		pos += next
+	}
+	for pos := 0; pos < len(buf); {
+		kind, key, valOff, valLen, next, _ := decodeEntry(buf[pos:])
+		if kind == entryKindPut {
+			db.index[string(key)] = valuePos{segment: id, offset: offset + int64(pos+valOff), size: uint32(valLen)}
+		} else {
+			delete(db.index, string(key))
+		}
+		pos += next
+	}
+	return true
+}
+
+// UpdatePreimage records the preimage if it is not known yet, the preimage is
+// lost silently if it can not be written
+func (db *FileDatabase) UpdatePreimage(preimage []byte, hashField *big.Int) {
+	if _, ok := db.Preimage(hashField); ok || hashField == nil {
+		return
+	}
+	_ = db.preimages.Put(zkt.NewHashFromBigInt(hashField)[:], preimage)
+}
+
+func (db *FileDatabase) Preimage(hashField *big.Int) ([]byte, bool) {
+	if hashField == nil {
+		return nil, false
+	}
+	preimage, err := db.preimages.Get(zkt.NewHashFromBigInt(hashField)[:])
+	return preimage, err == nil
+}
+
+func (db *FileDatabase) Put(k, v []byte) error {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	if db.closed {
+		return ErrFileDbClosed
+	}
+	return db.write(encodeRecord(entryKindPut, k, v))
+}
+
+// NewBatch creates a batch whose writes are persisted atomically
+func (db *FileDatabase) NewBatch() Batch {
+	return &fileBatch{db: db}
+}
+
+// write appends a record to the active segment and updates the index, it
+// must be called with the write lock held
+func (db *FileDatabase) write(rec []byte) error {
+	if db.size > 0 && db.size >= db.opts.SegmentSize {
+		if err := db.rotate(); err != nil {
+			return err
+		}
+	}
+
+	f := db.segments[db.active]
+	if _, err := f.WriteAt(rec, db.size); err != nil {
+		// drop the partial record so it would not be read as a valid one
+		_ = f.Truncate(db.size)
+		return err
+	}
+	db.applyRecord(db.active, db.size, rec)
+	db.size += int64(len(rec))
+	if db.opts.SyncWrites {
+		return f.Sync()
+	}
+	return nil
+}
+
+// rotate syncs the active segment and starts a new one
+func (db *FileDatabase) rotate() error {
+	if err := db.segments[db.active].Sync(); err != nil {
+		return err
+	}
+	id := db.active + 1
+	f, err := os.OpenFile(db.segmentPath(id), os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	db.segments[id] = f
+	db.active, db.size = id, 0
+	return db.syncDir()
+}
+
+func (db *FileDatabase) Get(key []byte) ([]byte, error) {
+	db.lock.RLock()
+	defer db.lock.RUnlock()
+
+	if db.closed {
+		return nil, ErrFileDbClosed
+	}
+	pos, ok := db.index[string(key)]
+	if !ok {
+		return nil, ErrKeyNotFound
+	}
+
+	value := make([]byte, pos.size)
+	if _, err := db.segments[pos.segment].ReadAt(value, pos.offset); err != nil {
+		return nil, err
+	}
+	return value, nil
+}
+
+func (db *FileDatabase) ForEach(fn func(k, v []byte) error) error {
+	db.lock.RLock()
+	defer db.lock.RUnlock()
+
+	if db.closed {
+		return ErrFileDbClosed
+	}
+	for k, pos := range db.index {
+		value := make([]byte, pos.size)
+		if _, err := db.segments[pos.segment].ReadAt(value, pos.offset); err != nil {
+			return err
+		}
+		if err := fn([]byte(k), value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Compact rewrites all the live k/v into new segments and removes the old
+// ones, so the space taken by the overridden and deleted entries is reclaimed.
+// The new segments are written as temporary files, synced and then renamed,
+// and the old segments are removed in ascending order only after that, so
+// the db can be recovered to the same state if crash at any point. If the
+// rewriting fails, the temporary files are removed and the db is unchanged
+func (db *FileDatabase) Compact() error {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	if db.closed {
+		return ErrFileDbClosed
+	}
+
+	var old []uint32
+	for id := range db.segments {
+		old = append(old, id)
+	}
+	sort.Slice(old, func(i, j int) bool { return old[i] < old[j] })
+
+	segments, index, size, err := db.rewrite()
+	if err != nil {
+		return err
+	}
+	var ids []uint32
+	for id := range segments {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	if err := db.publish(ids); err != nil {
+		for _, f := range segments {
+			f.Close()
+		}
+		return err
+	}
+
+	// the new segments are durable, switch to them
+	for _, id := range old {
+		db.segments[id].Close()
+		delete(db.segments, id)
+	}
+	for id, f := range segments {
+		db.segments[id] = f
+	}
+	db.index = index
+	db.active, db.size = ids[len(ids)-1], size
+
+	for _, id := range old {
+		if err := os.Remove(db.segmentPath(id)); err != nil {
+			return err
+		}
+	}
+	return db.syncDir()
+}
+
+// publish renames the temporary segments into segments and syncs the
+// directory. If it fails, the new segments would shadow the later writes into
+// the old ones, so all of them are removed, and the db is closed if even the
+// removing fails
+func (db *FileDatabase) publish(ids []uint32) error {
+	var err error
+	for i := 0; err == nil && i < len(ids); i++ {
+		err = os.Rename(db.tmpSegmentPath(ids[i]), db.segmentPath(ids[i]))
+	}
+	if err == nil {
+		if err = db.syncDir(); err == nil {
+			return nil
+		}
+	}
+
+	for _, id := range ids {
+		_ = os.Remove(db.tmpSegmentPath(id))
+		if removeErr := os.Remove(db.segmentPath(id)); removeErr != nil && !os.IsNotExist(removeErr) {
+			db.closed = true
+		}
+	}
+	if db.closed {
+		db.closeSegments()
+	}
+	return err
+}
+
+// rewrite writes all the live k/v into new temporary segments after the
+// active one, it returns the synced segments, the index over them and the size
+// of the last segment. The temporary segments are removed if it fails
+func (db *FileDatabase) rewrite() (map[uint32]*os.File, map[string]valuePos, int64, error) {
+	segments := make(map[uint32]*os.File)
+	index := make(map[string]valuePos, len(db.index))
+	fail := func(err error) (map[uint32]*os.File, map[string]valuePos, int64, error) {
+		for id, f := range segments {
+			f.Close()
+			_ = os.Remove(db.tmpSegmentPath(id))
+		}
+		return nil, nil, 0, err
+	}
+
+	id := db.active
+	var f *os.File
+	var size int64
+	next := func() error {
+		if f != nil {
+			if err := f.Sync(); err != nil {
+				return err
+			}
+		}
+		id++
+		tmp, err := os.OpenFile(db.tmpSegmentPath(id), os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
+		if err != nil {
+			return err
+		}
+		segments[id], f, size = tmp, tmp, 0
+		return nil
+	}
+
+	if err := next(); err != nil {
+		return fail(err)
+	}
+	for k, pos := range db.index {
+		if size > 0 && size >= db.opts.SegmentSize {
+			if err := next(); err != nil {
+				return fail(err)
+			}
+		}
+		value := make([]byte, pos.size)
+		if _, err := db.segments[pos.segment].ReadAt(value, pos.offset); err != nil {
+			return fail(err)
+		}
+		rec := encodeRecord(entryKindPut, []byte(k), value)
+		if _, err := f.WriteAt(rec, size); err != nil {
+			return fail(err)
+		}
+		index[k] = valuePos{segment: id, offset: size + fileDbRecordHeader + int64(len(k)), size: pos.size}
+		size += int64(len(rec))
+	}
+	if err := f.Sync(); err != nil {
+		return fail(err)
+	}
+	return segments, index, size, nil
+}
+
+// Sync flushes the active segment to disk
+func (db *FileDatabase) Sync() error {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	if db.closed {
+		return ErrFileDbClosed
+	}
+	if db.preimages != nil {
+		if err := db.preimages.Sync(); err != nil {
+			return err
+		}
+	}
+	return db.segments[db.active].Sync()
+}
+
+// Close syncs and closes all the segments, the db can not be used after
+// being closed
+func (db *FileDatabase) Close() error {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	if db.closed {
+		return nil
+	}
+	db.closed = true
+	err := db.segments[db.active].Sync()
+	if closeErr := db.closeSegments(); err == nil {
+		err = closeErr
+	}
+	if db.preimages != nil {
+		if closeErr := db.preimages.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	return err
+}
+
+func (db *FileDatabase) closeSegments() error {
+	var err error
+	for id, f := range db.segments {
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+		delete(db.segments, id)
+	}
+	return err
+}
+
+type fileBatch struct {
+	db      *FileDatabase
+	entries []byte
+	size    int
+}
+
+func (b *fileBatch) Put(k, v []byte) error {
+	b.entries = appendEntry(b.entries, entryKindPut, k, v)
+	b.size += len(k) + len(v)
+	return nil
+}
+
+func (b *fileBatch) Delete(k []byte) error {
+	b.entries = appendEntry(b.entries, entryKindDelete, k, nil)
+	b.size += len(k)
+	return nil
+}
+
+func (b *fileBatch) ValueSize() int {
+	return b.size
+}
+
+func (b *fileBatch) Write() error {
+	if len(b.entries) == 0 {
+		return nil
+	}
+
+	b.db.lock.Lock()
+	defer b.db.lock.Unlock()
+
+	if b.db.closed {
+		return ErrFileDbClosed
+	}
+	return b.db.write(encodeRecord(entryKindBatch, nil, b.entries))
+}
+
+func (b *fileBatch) Reset() {
+	b.entries = b.entries[:0]
+	b.size = 0
+}
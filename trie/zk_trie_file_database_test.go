@@ -0,0 +1,267 @@
+package trie
+
+import (
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+
+	zkt "github.com/scroll-tech/zktrie/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFileDatabase(t *testing.T) {
+	dir := t.TempDir()
+	db, err := NewZkTrieFileDb(dir, &FileDbOptions{SegmentSize: 256})
+	assert.NoError(t, err)
+	db.UpdatePreimage(nil, nil)
+
+	for i := 0; i < 100; i++ {
+		key := []byte(fmt.Sprintf("key_%d", i))
+		value := []byte(fmt.Sprintf("value_%d", i))
+		assert.NoError(t, db.Put(key, value))
+	}
+	// override
+	assert.NoError(t, db.Put([]byte("key_0"), []byte("new_value")))
+
+	check := func(db *FileDatabase) {
+		for i := 1; i < 100; i++ {
+			value, err := db.Get([]byte(fmt.Sprintf("key_%d", i)))
+			assert.NoError(t, err)
+			assert.Equal(t, []byte(fmt.Sprintf("value_%d", i)), value)
+		}
+		value, err := db.Get([]byte("key_0"))
+		assert.NoError(t, err)
+		assert.Equal(t, []byte("new_value"), value)
+		value, err = db.Get([]byte("key_100"))
+		assert.Equal(t, ErrKeyNotFound, err)
+		assert.Nil(t, value)
+	}
+	check(db)
+
+	segments, err := filepath.Glob(filepath.Join(dir, "*"+fileDbSegmentSuffix))
+	assert.NoError(t, err)
+	assert.Greater(t, len(segments), 1)
+
+	assert.NoError(t, db.Close())
+	_, err = db.Get([]byte("key_0"))
+	assert.Equal(t, ErrFileDbClosed, err)
+	assert.Equal(t, ErrFileDbClosed, db.Put([]byte("key_0"), nil))
+
+	db, err = NewZkTrieFileDb(dir, &FileDbOptions{SegmentSize: 256, SyncWrites: true})
+	assert.NoError(t, err)
+	check(db)
+	assert.NoError(t, db.Close())
+}
+
+func TestFileDatabase_Recovery(t *testing.T) {
+	dir := t.TempDir()
+	db, err := NewZkTrieFileDb(dir, nil)
+	assert.NoError(t, err)
+	assert.NoError(t, db.Put([]byte("key_1"), []byte("value_1")))
+	assert.NoError(t, db.Put([]byte("key_2"), []byte("value_2")))
+	assert.NoError(t, db.Close())
+
+	segment := filepath.Join(dir, fmt.Sprintf("%08d%s", 0, fileDbSegmentSuffix))
+	info, err := os.Stat(segment)
+	assert.NoError(t, err)
+	validSize := info.Size()
+
+	// a torn write of the last record
+	rec := encodeRecord(entryKindPut, []byte("key_3"), []byte("value_3"))
+	f, err := os.OpenFile(segment, os.O_WRONLY|os.O_APPEND, 0644)
+	assert.NoError(t, err)
+	_, err = f.Write(rec[:len(rec)-2])
+	assert.NoError(t, err)
+	assert.NoError(t, f.Close())
+
+	db, err = NewZkTrieFileDb(dir, nil)
+	assert.NoError(t, err)
+	_, err = db.Get([]byte("key_3"))
+	assert.Equal(t, ErrKeyNotFound, err)
+	value, err := db.Get([]byte("key_2"))
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("value_2"), value)
+	info, err = os.Stat(segment)
+	assert.NoError(t, err)
+	assert.Equal(t, validSize, info.Size())
+
+	// the db is still writable after recovery
+	assert.NoError(t, db.Put([]byte("key_3"), []byte("value_3")))
+	assert.NoError(t, db.Close())
+
+	// a corrupted record at the tail
+	f, err = os.OpenFile(segment, os.O_RDWR, 0644)
+	assert.NoError(t, err)
+	_, err = f.WriteAt([]byte{0xff}, validSize+fileDbRecordHeader)
+	assert.NoError(t, err)
+	assert.NoError(t, f.Close())
+
+	db, err = NewZkTrieFileDb(dir, nil)
+	assert.NoError(t, err)
+	_, err = db.Get([]byte("key_3"))
+	assert.Equal(t, ErrKeyNotFound, err)
+	value, err = db.Get([]byte("key_1"))
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("value_1"), value)
+	assert.NoError(t, db.Close())
+}
+
+func TestFileDatabase_Batch(t *testing.T) {
+	dir := t.TempDir()
+	db, err := NewZkTrieFileDb(dir, nil)
+	assert.NoError(t, err)
+	assert.NoError(t, db.Put([]byte("key_0"), []byte("value_0")))
+
+	batch := db.NewBatch()
+	assert.NoError(t, batch.Put([]byte("key_1"), []byte("value_1")))
+	assert.NoError(t, batch.Put([]byte("key_2"), []byte("value_2")))
+	assert.NoError(t, batch.Delete([]byte("key_0")))
+	assert.Equal(t, 29, batch.ValueSize())
+	_, err = db.Get([]byte("key_1"))
+	assert.Equal(t, ErrKeyNotFound, err)
+	assert.NoError(t, batch.Write())
+
+	check := func(db *FileDatabase) {
+		_, err := db.Get([]byte("key_0"))
+		assert.Equal(t, ErrKeyNotFound, err)
+		for i := 1; i <= 2; i++ {
+			value, err := db.Get([]byte(fmt.Sprintf("key_%d", i)))
+			assert.NoError(t, err)
+			assert.Equal(t, []byte(fmt.Sprintf("value_%d", i)), value)
+		}
+	}
+	check(db)
+	assert.NoError(t, db.Close())
+
+	segment := filepath.Join(dir, fmt.Sprintf("%08d%s", 0, fileDbSegmentSuffix))
+	info, err := os.Stat(segment)
+	assert.NoError(t, err)
+	validSize := info.Size()
+
+	db, err = NewZkTrieFileDb(dir, nil)
+	assert.NoError(t, err)
+	check(db)
+
+	// a batch being torn by crash is dropped as a whole
+	batch = db.NewBatch()
+	assert.NoError(t, batch.Put([]byte("key_3"), []byte("value_3")))
+	assert.NoError(t, batch.Delete([]byte("key_1")))
+	assert.NoError(t, batch.Write())
+	assert.NoError(t, db.Close())
+	assert.NoError(t, os.Truncate(segment, validSize+fileDbRecordHeader+fileDbEntryHeader+5))
+
+	db, err = NewZkTrieFileDb(dir, nil)
+	assert.NoError(t, err)
+	check(db)
+	_, err = db.Get([]byte("key_3"))
+	assert.Equal(t, ErrKeyNotFound, err)
+	assert.NoError(t, db.Close())
+}
+
+func TestFileDatabase_Compact(t *testing.T) {
+	dir := t.TempDir()
+	db, err := NewZkTrieFileDb(dir, &FileDbOptions{SegmentSize: 256})
+	assert.NoError(t, err)
+
+	for i := 0; i < 100; i++ {
+		assert.NoError(t, db.Put([]byte(fmt.Sprintf("key_%d", i)), []byte(fmt.Sprintf("value_%d", i))))
+	}
+	for i := 0; i < 100; i += 2 {
+		assert.NoError(t, db.Put([]byte(fmt.Sprintf("key_%d", i)), nil))
+	}
+	check := func(db *FileDatabase) {
+		for i := 0; i < 100; i++ {
+			value, err := db.Get([]byte(fmt.Sprintf("key_%d", i)))
+			assert.NoError(t, err)
+			if i%2 == 0 {
+				assert.Empty(t, value)
+			} else {
+				assert.Equal(t, []byte(fmt.Sprintf("value_%d", i)), value)
+			}
+		}
+	}
+	listSegments := func() []string {
+		segments, err := filepath.Glob(filepath.Join(dir, "*"+fileDbSegmentSuffix+"*"))
+		assert.NoError(t, err)
+		return segments
+	}
+	before := listSegments()
+
+	// a directory at the path of the second temporary segment makes the
+	// rewriting fail after the first one has been written
+	blocker := db.tmpSegmentPath(db.active + 2)
+	assert.NoError(t, os.Mkdir(blocker, 0755))
+	assert.Error(t, db.Compact())
+	assert.NoError(t, os.Remove(blocker))
+	assert.Equal(t, before, listSegments())
+	check(db)
+
+	// the db is still usable and recovered to the same state
+	assert.NoError(t, db.Put([]byte("key_100"), []byte("value_100")))
+	assert.NoError(t, db.Close())
+	db, err = NewZkTrieFileDb(dir, &FileDbOptions{SegmentSize: 256})
+	assert.NoError(t, err)
+	check(db)
+
+	assert.NoError(t, db.Compact())
+	assert.Less(t, len(listSegments()), len(before))
+	for _, segment := range listSegments() {
+		assert.Equal(t, fileDbSegmentSuffix, filepath.Ext(segment))
+	}
+	check(db)
+	value, err := db.Get([]byte("key_100"))
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("value_100"), value)
+
+	// the temporary segments left by an interrupted compaction are removed
+	tmp := db.tmpSegmentPath(db.active + 1)
+	assert.NoError(t, os.WriteFile(tmp, []byte("partial"), 0644))
+	assert.NoError(t, db.Close())
+	db, err = NewZkTrieFileDb(dir, &FileDbOptions{SegmentSize: 256})
+	assert.NoError(t, err)
+	_, err = os.Stat(tmp)
+	assert.True(t, os.IsNotExist(err))
+	check(db)
+	assert.NoError(t, db.Close())
+}
+
+func TestFileDatabase_ZkTrie(t *testing.T) {
+	dir := t.TempDir()
+	db, err := NewZkTrieFileDb(dir, nil)
+	assert.NoError(t, err)
+
+	zkTrie, err := NewZkTrie(zkt.Byte32{}, db)
+	assert.NoError(t, err)
+	for i := 0; i < 10; i++ {
+		key := make([]byte, 32)
+		key[31] = byte(i + 1)
+		assert.NoError(t, zkTrie.TryUpdate(key, 1, []zkt.Byte32{{byte(i)}}))
+	}
+	root, _, err := zkTrie.Commit()
+	assert.NoError(t, err)
+	assert.NoError(t, db.Close())
+
+	db, err = NewZkTrieFileDb(dir, nil)
+	assert.NoError(t, err)
+	zkTrie, err = NewZkTrie(*zkt.NewByte32FromBytes(root.Bytes()), db)
+	assert.NoError(t, err)
+	for i := 0; i < 10; i++ {
+		key := make([]byte, 32)
+		key[31] = byte(i + 1)
+		value, err := zkTrie.TryGet(key)
+		assert.NoError(t, err)
+		assert.Equal(t, (&zkt.Byte32{byte(i)}).Bytes(), value)
+
+		// the key preimages are persisted
+		k, err := zkt.ToSecureKey(key)
+		assert.NoError(t, err)
+		preimage, ok := db.Preimage(k)
+		assert.True(t, ok)
+		assert.Equal(t, key, preimage)
+	}
+	_, ok := db.Preimage(big.NewInt(12345))
+	assert.False(t, ok)
+	assert.NoError(t, db.Close())
+}
@@ -40,17 +40,38 @@ var (
 	// ErrNotWritable is used when the ZkTrieImpl is not writable and a
 	// write function is called
 	ErrNotWritable = errors.New("merkle Tree not writable")
+	// ErrInvalidPath is used when an encoded binary path is invalid
+	ErrInvalidPath = errors.New("invalid binary path encoding")
+	// ErrInvalidValuePreimage is used when the value preimage of a leaf is
+	// empty or longer than maxValuePreimageLen
+	ErrInvalidValuePreimage = errors.New("invalid length of value preimage")
 
 	dbKeyRootNode = []byte("currentroot")
 )
 
+// maxValuePreimageLen is the maximum number of fields in the value preimage of
+// a leaf, as its length is encoded in one byte
+const maxValuePreimageLen = 255
+
+// checkValuePreimage verifies the value preimage can be encoded in a leaf
+func checkValuePreimage(vPreimage []zkt.Byte32) error {
+	if len(vPreimage) == 0 || len(vPreimage) > maxValuePreimageLen {
+		return ErrInvalidValuePreimage
+	}
+	return nil
+}
+
 // ZkTrieImpl is the struct with the main elements of the ZkTrieImpl
 type ZkTrieImpl struct {
 	db        ZktrieDatabase
+	hasher    zkt.Hasher
 	rootHash  *zkt.Hash
 	writable  bool
 	maxLevels int
 	Debug     bool
+	// dirty caches the nodes created since last commit, they are only
+	// flushed into db by Commit
+	dirty map[zkt.Hash]*Node
 }
 
 func NewZkTrieImpl(storage ZktrieDatabase, maxLevels int) (*ZkTrieImpl, error) {
@@ -60,7 +81,14 @@ func NewZkTrieImpl(storage ZktrieDatabase, maxLevels int) (*ZkTrieImpl, error) {
 // NewZkTrieImplWithRoot loads a new ZkTrieImpl. If in the storage already exists one
 // will open that one, if not, will create a new one.
 func NewZkTrieImplWithRoot(storage ZktrieDatabase, root *zkt.Hash, maxLevels int) (*ZkTrieImpl, error) {
-	mt := ZkTrieImpl{db: storage, maxLevels: maxLevels, writable: true}
+	return NewZkTrieImplWithRootAndHasher(storage, root, maxLevels, zkt.DefaultHasher)
+}
+
+// NewZkTrieImplWithRootAndHasher is the same as NewZkTrieImplWithRoot but the
+// trie use the specified hash scheme instead of the process-wide one
+func NewZkTrieImplWithRootAndHasher(storage ZktrieDatabase, root *zkt.Hash, maxLevels int, hasher zkt.Hasher) (*ZkTrieImpl, error) {
+	mt := ZkTrieImpl{db: storage, hasher: hasher, maxLevels: maxLevels, writable: true,
+		dirty: make(map[zkt.Hash]*Node)}
 	mt.rootHash = root
 	if *root != zkt.HashZero {
 		_, err := mt.GetNode(mt.rootHash)
@@ -82,13 +110,19 @@ func (mt *ZkTrieImpl) Root() *zkt.Hash {
 	return mt.rootHash
 }
 
+// Hasher returns the hash scheme used by the MT
+func (mt *ZkTrieImpl) Hasher() zkt.Hasher {
+	return mt.hasher
+}
+
 // MaxLevels returns the MT maximum level
 func (mt *ZkTrieImpl) MaxLevels() int {
 	return mt.maxLevels
 }
 
 // TryUpdate updates a nodeKey & value into the ZkTrieImpl. Where the `k` determines the
-// path from the Root to the Leaf. This also return the updated leaf node
+// path from the Root to the Leaf. This also return the updated leaf node.
+// An empty value deletes the nodeKey, deleting an unexisted key is not an error
 func (mt *ZkTrieImpl) TryUpdate(nodeKey *zkt.Hash, vFlag uint32, vPreimage []zkt.Byte32) error {
 	// verify that the ZkTrieImpl is writable
 	if !mt.writable {
@@ -99,12 +133,21 @@ func (mt *ZkTrieImpl) TryUpdate(nodeKey *zkt.Hash, vFlag uint32, vPreimage []zkt
 	if !zkt.CheckBigIntInField(nodeKey.BigInt()) {
 		return ErrInvalidField
 	}
+	if len(vPreimage) == 0 {
+		if err := mt.TryDelete(nodeKey); err != ErrKeyNotFound {
+			return err
+		}
+		return nil
+	}
+	if err := checkValuePreimage(vPreimage); err != nil {
+		return err
+	}
 
 	newLeafNode := NewLeafNode(nodeKey, vFlag, vPreimage)
 	path := getPath(mt.maxLevels, nodeKey[:])
 
 	// precalc NodeHash of new leaf here
-	if _, err := newLeafNode.NodeHash(); err != nil {
+	if _, err := newLeafNode.NodeHashWithHasher(mt.hasher); err != nil {
 		return err
 	}
 
@@ -116,11 +159,6 @@ func (mt *ZkTrieImpl) TryUpdate(nodeKey *zkt.Hash, vFlag uint32, vPreimage []zkt
 		return err
 	}
 	mt.rootHash = newRootHash
-	err = mt.dbInsert(dbKeyRootNode, DBEntryTypeRoot, mt.rootHash[:])
-	if err != nil {
-		return err
-	}
-
 	return nil
 }
 
@@ -145,11 +183,11 @@ func (mt *ZkTrieImpl) pushLeaf(newLeaf *Node, oldLeaf *Node, lvl int,
 		}
 		return mt.addNode(newParentNode)
 	}
-	oldLeafHash, err := oldLeaf.NodeHash()
+	oldLeafHash, err := oldLeaf.NodeHashWithHasher(mt.hasher)
 	if err != nil {
 		return nil, err
 	}
-	newLeafHash, err := newLeaf.NodeHash()
+	newLeafHash, err := newLeaf.NodeHashWithHasher(mt.hasher)
 	if err != nil {
 		return nil, err
 	}
@@ -196,7 +234,7 @@ func (mt *ZkTrieImpl) addLeaf(newLeaf *Node, currNodeHash *zkt.Hash,
 		// Check if leaf node found contains the leaf node we are
 		// trying to add
 		if bytes.Equal(n.NodeKey[:], newLeaf.NodeKey[:]) {
-			hash, err := n.NodeHash()
+			hash, err := n.NodeHashWithHasher(mt.hasher)
 			if err != nil {
 				//fmt.Println("err on obtain key of duplicated entry", err)
 				return nil, err
@@ -241,7 +279,7 @@ func (mt *ZkTrieImpl) addLeaf(newLeaf *Node, currNodeHash *zkt.Hash,
 	}
 }
 
-// addNode adds a node into the MT and returns the node hash. Empty nodes are
+// addNode adds a node into the dirty set of MT and returns the node hash. Empty nodes are
 // not stored in the tree since they are all the same and assumed to always exist.
 func (mt *ZkTrieImpl) addNode(n *Node) (*zkt.Hash, error) {
 	// verify that the ZkTrieImpl is writable
@@ -249,16 +287,21 @@ func (mt *ZkTrieImpl) addNode(n *Node) (*zkt.Hash, error) {
 		return nil, ErrNotWritable
 	}
 	if n.Type == NodeTypeEmpty {
-		return n.NodeHash()
+		return n.NodeHashWithHasher(mt.hasher)
 	}
-	hash, err := n.NodeHash()
+	hash, err := n.NodeHashWithHasher(mt.hasher)
 	if err != nil {
 		return nil, err
 	}
 	v := n.CanonicalValue()
 	// Check that the node key doesn't already exist
-	oldV, err := mt.db.Get(hash[:])
-	if err == nil {
+	var oldV []byte
+	if oldN, ok := mt.dirty[*hash]; ok {
+		oldV = oldN.CanonicalValue()
+	} else if oldV, err = mt.db.Get(hash[:]); err != nil {
+		oldV = nil
+	}
+	if oldV != nil {
 		if !bytes.Equal(oldV, v) {
 			//fmt.Printf("Encounter conflicted node hash: %x, old value %x and new %x\n", hash, oldV, v)
 			return nil, ErrNodeKeyAlreadyExists
@@ -267,11 +310,11 @@ func (mt *ZkTrieImpl) addNode(n *Node) (*zkt.Hash, error) {
 			return hash, nil
 		}
 	}
-	err = mt.db.Put(hash[:], v)
-	return hash, err
+	mt.dirty[*hash] = n
+	return hash, nil
 }
 
-// updateNode updates an existing node in the MT.  Empty nodes are not stored
+// updateNode updates an existing node in the dirty set of MT.  Empty nodes are not stored
 // in the tree; they are all the same and assumed to always exist.
 func (mt *ZkTrieImpl) updateNode(n *Node) (*zkt.Hash, error) {
 	// verify that the ZkTrieImpl is writable
@@ -279,15 +322,14 @@ func (mt *ZkTrieImpl) updateNode(n *Node) (*zkt.Hash, error) {
 		return nil, ErrNotWritable
 	}
 	if n.Type == NodeTypeEmpty {
-		return n.NodeHash()
+		return n.NodeHashWithHasher(mt.hasher)
 	}
-	hash, err := n.NodeHash()
+	hash, err := n.NodeHashWithHasher(mt.hasher)
 	if err != nil {
 		return nil, err
 	}
-	v := n.CanonicalValue()
-	err = mt.db.Put(hash[:], v)
-	return hash, err
+	mt.dirty[*hash] = n
+	return hash, nil
 }
 
 func (mt *ZkTrieImpl) tryGet(nodeKey *zkt.Hash) (*Node, []*zkt.Hash, error) {
@@ -339,16 +381,17 @@ func (mt *ZkTrieImpl) TryGet(nodeKey *zkt.Hash) ([]byte, error) {
 	return node.Data(), nil
 }
 
-// Delete removes the specified Key from the ZkTrieImpl and updates the path
+// TryDelete removes the specified Key from the ZkTrieImpl and updates the path
 // from the deleted key to the Root with the new values.  This method removes
 // the key from the ZkTrieImpl, but does not remove the old nodes from the
 // key-value database; this means that if the tree is accessed by an old Root
-// where the key was not deleted yet, the key will still exist. If is desired
+// where the key was not deleted yet, the key will still exist. If it is desired
 // to remove the key-values from the database that are not under the current
-// Root, an option could be to dump all the leafs (using mt.DumpLeafs) and
-// import them in a new ZkTrieImpl in a new database (using
-// mt.ImportDumpedLeafs), but this will lose all the Root history of the
-// ZkTrieImpl
+// Root, RefCountDatabase can be used to delete the nodes no longer referenced
+// by any live root, or Prune can be run with the roots to be retained. Another
+// option could be to dump all the leafs (using mt.DumpLeafs) and import them
+// in a new ZkTrieImpl in a new database (using mt.ImportDumpedLeafs), but this
+// will lose all the Root history of the ZkTrieImpl
 func (mt *ZkTrieImpl) TryDelete(nodeKey *zkt.Hash) error {
 	// verify that the ZkTrieImpl is writable
 	if !mt.writable {
@@ -406,7 +449,6 @@ func (mt *ZkTrieImpl) rmAndUpload(path []bool, nodeKey *zkt.Hash, siblings []*zk
 				panic("finalRoot is not set yet")
 			}
 			mt.rootHash = finalRoot
-			err = mt.dbInsert(dbKeyRootNode, DBEntryTypeRoot, mt.rootHash[:])
 		}
 	}()
 
@@ -463,7 +505,7 @@ func (mt *ZkTrieImpl) rmAndUpload(path []bool, nodeKey *zkt.Hash, siblings []*zk
 func (mt *ZkTrieImpl) recalculatePathUntilRoot(path []bool, node *Node,
 	siblings []*zkt.Hash) (*zkt.Hash, error) {
 	for i := len(siblings) - 1; i >= 0; i-- {
-		nodeHash, err := node.NodeHash()
+		nodeHash, err := node.NodeHashWithHasher(mt.hasher)
 		if err != nil {
 			return nil, err
 		}
@@ -479,15 +521,129 @@ func (mt *ZkTrieImpl) recalculatePathUntilRoot(path []bool, node *Node,
 	}
 
 	// return last node added, which is the root
-	nodeHash, err := node.NodeHash()
+	nodeHash, err := node.NodeHashWithHasher(mt.hasher)
 	return nodeHash, err
 }
 
+// NodeSet contains the nodes being flushed into the db by a Commit
+type NodeSet struct {
+	// Root is the root hash of the committed trie
+	Root zkt.Hash
+	// Nodes are the committed nodes indexed by their node hash
+	Nodes map[zkt.Hash]*Node
+}
+
+// Len returns the number of nodes in the set
+func (set *NodeSet) Len() int {
+	return len(set.Nodes)
+}
+
+// Commit writes all the dirty nodes reachable from the current root into the
+// db, along with the current root entry, then resets the dirty set. Nodes
+// which have been replaced by later updates are discarded without being written.
+// If the db implements Batcher, all the writes are applied in one batch.
+// It returns the root and the set of nodes being written
+func (mt *ZkTrieImpl) Commit() (*zkt.Hash, *NodeSet, error) {
+	// verify that the ZkTrieImpl is writable
+	if !mt.writable {
+		return nil, nil, ErrNotWritable
+	}
+
+	var w kvWriter = mt.db
+	var batch Batch
+	if batcher, ok := mt.db.(Batcher); ok {
+		batch = batcher.NewBatch()
+		w = batch
+	}
+
+	set := &NodeSet{Root: *mt.rootHash, Nodes: make(map[zkt.Hash]*Node)}
+	if err := mt.commit(w, mt.rootHash, set); err != nil {
+		return nil, nil, err
+	}
+	if err := mt.dbInsert(w, dbKeyRootNode, DBEntryTypeRoot, mt.rootHash[:]); err != nil {
+		return nil, nil, err
+	}
+	if batch != nil {
+		if err := batch.Write(); err != nil {
+			return nil, nil, err
+		}
+	}
+	mt.dirty = make(map[zkt.Hash]*Node)
+	return mt.rootHash, set, nil
+}
+
+// commit recursively writes the dirty node and its dirty descendants, the
+// children of a committed node must have been committed so the traversal
+// stops at the first node not in dirty set
+func (mt *ZkTrieImpl) commit(w kvWriter, nodeHash *zkt.Hash, set *NodeSet) error {
+	n, ok := mt.dirty[*nodeHash]
+	if !ok {
+		return nil
+	}
+	if _, ok := set.Nodes[*nodeHash]; ok {
+		return nil
+	}
+	if n.Type == NodeTypeParent {
+		if err := mt.commit(w, n.ChildL, set); err != nil {
+			return err
+		}
+		if err := mt.commit(w, n.ChildR, set); err != nil {
+			return err
+		}
+	}
+	if err := w.Put(nodeHash[:], n.CanonicalValue()); err != nil {
+		return err
+	}
+	set.Nodes[*nodeHash] = n
+	return nil
+}
+
+// Copy returns a copy of the MT which shares the same db, the uncommitted
+// nodes are also copied so both of them can be updated independently
+func (mt *ZkTrieImpl) Copy() *ZkTrieImpl {
+	cpy := *mt
+	cpy.dirty = make(map[zkt.Hash]*Node, len(mt.dirty))
+	for k, n := range mt.dirty {
+		cpy.dirty[k] = n
+	}
+	return &cpy
+}
+
+// kvWriter is the write side shared by ZktrieDatabase and Batch
+type kvWriter interface {
+	Put(k, v []byte) error
+}
+
+// AsReadOnly returns a read-only view of the MT, including the uncommitted
+// nodes. All the mutations on the view return ErrNotWritable and nothing is
+// written into the db through it
+func (mt *ZkTrieImpl) AsReadOnly() *ZkTrieImpl {
+	cpy := mt.Copy()
+	cpy.writable = false
+	return cpy
+}
+
+// IsWritable reports whether the MT can be modified
+func (mt *ZkTrieImpl) IsWritable() bool {
+	return mt.writable
+}
+
 // dbInsert is a helper function to insert a node into a key in an open db
 // transaction.
-func (mt *ZkTrieImpl) dbInsert(k []byte, t NodeType, data []byte) error {
+func (mt *ZkTrieImpl) dbInsert(w kvWriter, k []byte, t NodeType, data []byte) error {
+	// verify that the ZkTrieImpl is writable
+	if !mt.writable {
+		return ErrNotWritable
+	}
 	v := append([]byte{byte(t)}, data...)
-	return mt.db.Put(k, v)
+	return w.Put(k, v)
+}
+
+// KeyPreimage returns the original key of nodeKey (e.g. the address or the
+// storage slot), if it has been recorded in the db when the key was updated
+// through ZkTrie
+func (mt *ZkTrieImpl) KeyPreimage(nodeKey *zkt.Hash) ([]byte, bool) {
+	return mt.db.Preimage(nodeKey.BigInt())
 }
 
 // GetLeafNode is more underlying method than TryGet, which obtain an leaf node
@@ -498,12 +654,20 @@ func (mt *ZkTrieImpl) GetLeafNode(nodeKey *zkt.Hash) (*Node, error) {
 }
 
 // GetNode gets a node by node hash from the MT.  Empty nodes are not stored in the
-// tree; they are all the same and assumed to always exist.
+// tree; they are all the same and assumed to always exist. Uncommitted nodes are
+// resolved from the dirty set before the db is being queried.
 // <del>for non exist key, return (NewEmptyNode(), nil)</del>
 func (mt *ZkTrieImpl) GetNode(nodeHash *zkt.Hash) (*Node, error) {
 	if bytes.Equal(nodeHash[:], zkt.HashZero[:]) {
 		return NewEmptyNode(), nil
 	}
+	if n, ok := mt.dirty[*nodeHash]; ok {
+		// return a copy so caller can not modify the cached one
+		return n.Copy(), nil
+	}
+	if r, ok := mt.db.(NodeReader); ok {
+		return r.GetNode(nodeHash)
+	}
 	nBytes, err := mt.db.Get(nodeHash[:])
 	if err == ErrKeyNotFound {
 		return nil, ErrKeyNotFound
@@ -522,6 +686,76 @@ func getPath(numLevels int, k []byte) []bool {
 	return path
 }
 
+// EncodeBinaryPath encodes a binary path from the root into bytes: the first
+// byte is the number of bits in path, followed by the bits packed in the same
+// LSB-first order as node key, i.e. the bit n is the (n%8)-th bit of byte n/8.
+// ErrInvalidPath is returned if the path is longer than 255 bits
+func EncodeBinaryPath(path []bool) ([]byte, error) {
+	if len(path) > 255 {
+		return nil, ErrInvalidPath
+	}
+	ret := make([]byte, 1+(len(path)+7)/8)
+	ret[0] = byte(len(path))
+	for i, bit := range path {
+		if bit {
+			ret[1+i/8] |= 1 << (i % 8)
+		}
+	}
+	return ret, nil
+}
+
+// DecodeBinaryPath decodes the bytes encoded by EncodeBinaryPath
+func DecodeBinaryPath(b []byte) ([]bool, error) {
+	if len(b) < 1 {
+		return nil, ErrInvalidPath
+	}
+	l := int(b[0])
+	bits := b[1:]
+	if len(bits) != (l+7)/8 {
+		return nil, ErrInvalidPath
+	}
+	// unused bits must be zero so the encoding is canonical
+	if l%8 != 0 && bits[len(bits)-1]>>(l%8) != 0 {
+		return nil, ErrInvalidPath
+	}
+	path := make([]bool, l)
+	for i := range path {
+		path[i] = zkt.TestBit(bits, uint(i))
+	}
+	return path, nil
+}
+
+// GetNodeByPath returns the node located at the path from the root and the
+// number of path bits being resolved. If there is no node at the path (the
+// path reaches an empty sub-trie or goes through a leaf), a nil node is returned
+func (mt *ZkTrieImpl) GetNodeByPath(path []bool) (*Node, int, error) {
+	nextHash := mt.rootHash
+	for i := 0; ; i++ {
+		n, err := mt.GetNode(nextHash)
+		if err != nil {
+			return nil, i, err
+		}
+		if n.Type == NodeTypeEmpty {
+			return nil, i, nil
+		}
+		if i == len(path) {
+			return n, i, nil
+		}
+		switch n.Type {
+		case NodeTypeLeaf:
+			return nil, i, nil
+		case NodeTypeParent:
+			if path[i] {
+				nextHash = n.ChildR
+			} else {
+				nextHash = n.ChildL
+			}
+		default:
+			return nil, i, ErrInvalidNodeFound
+		}
+	}
+}
+
 // NodeAux contains the auxiliary node used in a non-existence proof.
 type NodeAux struct {
 	Key   *zkt.Hash // Key is the node key
@@ -548,6 +782,13 @@ type Proof struct {
 // BuildZkTrieProof prove uniformed way to turn some data collections into Proof struct
 func BuildZkTrieProof(rootHash *zkt.Hash, k *big.Int, lvl int, getNode func(key *zkt.Hash) (*Node, error)) (*Proof,
 	*Node, error) {
+	return BuildZkTrieProofWithHasher(zkt.DefaultHasher, rootHash, k, lvl, getNode)
+}
+
+// BuildZkTrieProofWithHasher is the same as BuildZkTrieProof but use the specified
+// hash scheme for the value hash of the auxiliary node in a non-existence proof
+func BuildZkTrieProofWithHasher(h zkt.Hasher, rootHash *zkt.Hash, k *big.Int, lvl int,
+	getNode func(key *zkt.Hash) (*Node, error)) (*Proof, *Node, error) {
 
 	p := &Proof{}
 	var siblingHash *zkt.Hash
@@ -570,7 +811,11 @@ func BuildZkTrieProof(rootHash *zkt.Hash, k *big.Int, lvl int, getNode func(key
 				return p, n, nil
 			}
 			// We found a leaf whose entry didn't match hIndex
-			p.NodeAux = &NodeAux{Key: n.NodeKey, Value: n.valueHash}
+			valueHash, err := n.ValueHashWithHasher(h)
+			if err != nil {
+				return nil, nil, err
+			}
+			p.NodeAux = &NodeAux{Key: n.NodeKey, Value: valueHash}
 			return p, n, nil
 		case NodeTypeParent:
 			if path[p.depth] {
@@ -594,12 +839,18 @@ func BuildZkTrieProof(rootHash *zkt.Hash, k *big.Int, lvl int, getNode func(key
 
 // VerifyProof verifies the Merkle Proof for the entry and root.
 func VerifyProofZkTrie(rootHash *zkt.Hash, proof *Proof, node *Node) bool {
-	nodeHash, err := node.NodeHash()
+	return VerifyProofZkTrieWithHasher(zkt.DefaultHasher, rootHash, proof, node)
+}
+
+// VerifyProofZkTrieWithHasher is the same as VerifyProofZkTrie but use the
+// specified hash scheme
+func VerifyProofZkTrieWithHasher(h zkt.Hasher, rootHash *zkt.Hash, proof *Proof, node *Node) bool {
+	nodeHash, err := node.NodeHashWithHasher(h)
 	if err != nil {
 		return false
 	}
 
-	rootFromProof, err := proof.Verify(nodeHash, node.NodeKey)
+	rootFromProof, err := proof.VerifyWithHasher(h, nodeHash, node.NodeKey)
 	if err != nil {
 		return false
 	}
@@ -609,29 +860,34 @@ func VerifyProofZkTrie(rootHash *zkt.Hash, proof *Proof, node *Node) bool {
 // Verify the proof and calculate the root, nodeHash can be nil when try to verify
 // a nonexistent proof
 func (proof *Proof) Verify(nodeHash, nodeKey *zkt.Hash) (*zkt.Hash, error) {
+	return proof.VerifyWithHasher(zkt.DefaultHasher, nodeHash, nodeKey)
+}
+
+// VerifyWithHasher is the same as Verify but use the specified hash scheme
+func (proof *Proof) VerifyWithHasher(h zkt.Hasher, nodeHash, nodeKey *zkt.Hash) (*zkt.Hash, error) {
 	if proof.Existence {
 		if nodeHash == nil {
 			return nil, ErrKeyNotFound
 		}
-		return proof.rootFromProof(nodeHash, nodeKey)
+		return proof.rootFromProof(h, nodeHash, nodeKey)
 	} else {
 		if proof.NodeAux == nil {
-			return proof.rootFromProof(&zkt.HashZero, nodeKey)
+			return proof.rootFromProof(h, &zkt.HashZero, nodeKey)
 		} else {
 			if bytes.Equal(nodeKey[:], proof.NodeAux.Key[:]) {
 				return nil, fmt.Errorf("non-existence proof being checked against hIndex equal to nodeAux")
 			}
-			midHash, err := LeafHash(proof.NodeAux.Key, proof.NodeAux.Value)
+			midHash, err := LeafHashWithHasher(h, proof.NodeAux.Key, proof.NodeAux.Value)
 			if err != nil {
 				return nil, err
 			}
-			return proof.rootFromProof(midHash, nodeKey)
+			return proof.rootFromProof(h, midHash, nodeKey)
 		}
 	}
 
 }
 
-func (proof *Proof) rootFromProof(nodeHash, nodeKey *zkt.Hash) (*zkt.Hash, error) {
+func (proof *Proof) rootFromProof(h zkt.Hasher, nodeHash, nodeKey *zkt.Hash) (*zkt.Hash, error) {
 	var err error
 
 	sibIdx := len(proof.Siblings) - 1
@@ -645,12 +901,12 @@ func (proof *Proof) rootFromProof(nodeHash, nodeKey *zkt.Hash) (*zkt.Hash, error
 			siblingHash = &zkt.HashZero
 		}
 		if path[lvl] {
-			nodeHash, err = NewParentNode(siblingHash, nodeHash).NodeHash()
+			nodeHash, err = NewParentNode(siblingHash, nodeHash).NodeHashWithHasher(h)
 			if err != nil {
 				return nil, err
 			}
 		} else {
-			nodeHash, err = NewParentNode(nodeHash, siblingHash).NodeHash()
+			nodeHash, err = NewParentNode(nodeHash, siblingHash).NodeHashWithHasher(h)
 			if err != nil {
 				return nil, err
 			}
@@ -713,7 +969,7 @@ node [fontname=Monospace,fontsize=10,shape=box]
 	cnt := 0
 	var errIn error
 	err := mt.Walk(rootHash, func(n *Node) {
-		hash, err := n.NodeHash()
+		hash, err := n.NodeHashWithHasher(mt.hasher)
 		if err != nil {
 			errIn = err
 		}
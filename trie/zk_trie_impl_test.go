@@ -2,6 +2,7 @@ package trie
 
 import (
 	"bytes"
+	"errors"
 	"math/big"
 	"testing"
 
@@ -88,6 +89,8 @@ func TestMerkleTree_Init(t *testing.T) {
 		assert.Equal(t, zkt.HashZero.Bytes(), mt1.Root().Bytes())
 		err = mt1.TryUpdate(zkt.NewHashFromBytes([]byte{1}), 1, []zkt.Byte32{{byte(1)}})
 		assert.NoError(t, err)
+		_, _, err = mt1.Commit()
+		assert.NoError(t, err)
 
 		mt2, err := NewZkTrieImplWithRoot(db, mt1.Root(), maxLevels)
 		assert.NoError(t, err)
@@ -479,6 +482,28 @@ func TestZkTrieImpl_Delete(t *testing.T) {
 		err := mt.DeleteWord(k1)
 		assert.Equal(t, ErrKeyNotFound, err)
 	})
+
+	t.Run("Test deletion by empty value", func(t *testing.T) {
+		mt1 := newTestingMerkle(t, 10)
+		mt2 := newTestingMerkle(t, 10)
+		for i, key := range []*zkt.Byte32{k1, k2, k3} {
+			err := mt1.AddWord(key, zkt.NewByte32FromBytes([]byte{byte(i + 1)}))
+			assert.NoError(t, err)
+			err = mt2.AddWord(key, zkt.NewByte32FromBytes([]byte{byte(i + 1)}))
+			assert.NoError(t, err)
+		}
+
+		err := mt1.DeleteWord(k2)
+		assert.NoError(t, err)
+		err = mt2.TryUpdate(zkt.NewHashFromBytes(k2[:]), 1, nil)
+		assert.NoError(t, err)
+		assert.Equal(t, mt1.Root().Bytes(), mt2.Root().Bytes())
+
+		// deleting a non-existent key by empty value is not an error
+		err = mt2.TryUpdate(zkt.NewHashFromBytes(k4[:]), 1, []zkt.Byte32{})
+		assert.NoError(t, err)
+		assert.Equal(t, mt1.Root().Bytes(), mt2.Root().Bytes())
+	})
 }
 
 func TestMerkleTree_BuildAndVerifyZkTrieProof(t *testing.T) {
@@ -557,3 +582,156 @@ func TestMerkleTree_GraphViz(t *testing.T) {
 	assert.Equal(t, "--------\nGraphViz of the ZkTrieImpl with RootHash 4467834053890953620178129130613022752584671477523987938903027600190138488269\ndigraph hierarchy {\nnode [fontname=Monospace,fontsize=10,shape=box]\n\"44678340...\" -> {\"empty0\" \"63478298...\"}\n\"empty0\" [style=dashed,label=0];\n\"63478298...\" -> {\"14984317...\" \"12008367...\"}\n\"14984317...\" [style=filled];\n\"12008367...\" [style=filled];\n}\nEnd of GraphViz of the ZkTrieImpl with RootHash 4467834053890953620178129130613022752584671477523987938903027600190138488269\n--------\n", buffer.String())
 	buffer.Reset()
 }
+
+func TestZkTrieImpl_Commit(t *testing.T) {
+	db := NewZkTrieMemoryDb()
+	mt, err := newZkTrieImpl(db, 10)
+	assert.NoError(t, err)
+
+	for i := 0; i < 8; i++ {
+		for j := 0; j < 4; j++ {
+			err := mt.UpdateWord(zkt.NewByte32FromBytes([]byte{byte(i)}), zkt.NewByte32FromBytes([]byte{byte(j)}))
+			assert.NoError(t, err)
+		}
+	}
+	err = mt.DeleteWord(zkt.NewByte32FromBytes([]byte{byte(7)}))
+	assert.NoError(t, err)
+	assert.Equal(t, 0, len(db.db))
+
+	// uncommitted nodes are readable
+	for i := 0; i < 7; i++ {
+		node, err := mt.GetLeafNodeByWord(zkt.NewByte32FromBytes([]byte{byte(i)}))
+		assert.NoError(t, err)
+		assert.Equal(t, zkt.NewByte32FromBytes([]byte{3})[:], node.ValuePreimage[0][:])
+	}
+
+	_, err = NewZkTrieImplWithRoot(db, mt.Root(), 10)
+	assert.Equal(t, ErrKeyNotFound, err)
+
+	root, set, err := mt.Commit()
+	assert.NoError(t, err)
+	assert.Equal(t, mt.Root(), root)
+	assert.Equal(t, *root, set.Root)
+
+	reachable := 0
+	err = mt.Walk(root, func(n *Node) {
+		if n.Type != NodeTypeEmpty {
+			reachable++
+		}
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, reachable, set.Len())
+	// all reachable nodes plus the root entry
+	assert.Equal(t, reachable+1, len(db.db))
+
+	mt2, err := newZkTrieImplWithRoot(db, root, 10)
+	assert.NoError(t, err)
+	for i := 0; i < 7; i++ {
+		node, err := mt2.GetLeafNodeByWord(zkt.NewByte32FromBytes([]byte{byte(i)}))
+		assert.NoError(t, err)
+		assert.Equal(t, zkt.NewByte32FromBytes([]byte{3})[:], node.ValuePreimage[0][:])
+	}
+
+	// commit without any change writes nothing
+	_, set, err = mt.Commit()
+	assert.NoError(t, err)
+	assert.Equal(t, 0, set.Len())
+}
+
+func TestZkTrieImpl_GetNodeCopy(t *testing.T) {
+	mt, err := NewZkTrieImpl(NewZkTrieMemoryDb(), 10)
+	assert.NoError(t, err)
+	k := zkt.NewHashFromBytes([]byte{1})
+	assert.NoError(t, mt.TryUpdate(k, 1, []zkt.Byte32{{1}}))
+	root := *mt.Root()
+
+	// modifying the resolved uncommitted node does not affect the trie
+	node, err := mt.GetNode(mt.Root())
+	assert.NoError(t, err)
+	node.ValuePreimage[0] = zkt.Byte32{2}
+	node.NodeKey[0] = 2
+
+	node, err = mt.GetLeafNode(k)
+	assert.NoError(t, err)
+	assert.Equal(t, zkt.Byte32{1}, node.ValuePreimage[0])
+	assert.Equal(t, k, node.NodeKey)
+	_, set, err := mt.Commit()
+	assert.NoError(t, err)
+	hash, err := set.Nodes[root].NodeHash()
+	assert.NoError(t, err)
+	assert.Equal(t, root, *hash)
+	assert.Equal(t, zkt.Byte32{1}, set.Nodes[root].ValuePreimage[0])
+}
+
+// failingBatchDb is a db whose batches can not be written
+type failingBatchDb struct {
+	*Database
+}
+
+func (db failingBatchDb) NewBatch() Batch {
+	return failingBatch{db.Database.NewBatch()}
+}
+
+type failingBatch struct {
+	Batch
+}
+
+func (b failingBatch) Write() error {
+	return errors.New("batch write failed")
+}
+
+func TestZkTrieImpl_CommitBatch(t *testing.T) {
+	db := failingBatchDb{NewZkTrieMemoryDb()}
+	mt, err := newZkTrieImpl(db, 10)
+	assert.NoError(t, err)
+
+	for i := 0; i < 8; i++ {
+		err := mt.UpdateWord(zkt.NewByte32FromBytes([]byte{byte(i)}), zkt.NewByte32FromBytes([]byte{byte(i)}))
+		assert.NoError(t, err)
+	}
+	_, _, err = mt.Commit()
+	assert.Error(t, err)
+	// nothing is written when the batch fails
+	assert.Equal(t, 0, len(db.db))
+
+	// the uncommitted nodes are kept and can be committed later
+	mt.db = db.Database
+	root, set, err := mt.Commit()
+	assert.NoError(t, err)
+	assert.Equal(t, set.Len()+1, len(db.db))
+	_, err = newZkTrieImplWithRoot(db.Database, root, 10)
+	assert.NoError(t, err)
+}
+
+func TestBinaryPathEncoding(t *testing.T) {
+	path := []bool{true, false, true, true, false, false, false, false, true, true}
+	b, err := EncodeBinaryPath(path)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{10, 0b00001101, 0b00000011}, b)
+	decoded, err := DecodeBinaryPath(b)
+	assert.NoError(t, err)
+	assert.Equal(t, path, decoded)
+
+	b, err = EncodeBinaryPath(nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{0}, b)
+	decoded, err = DecodeBinaryPath(b)
+	assert.NoError(t, err)
+	assert.Empty(t, decoded)
+
+	k := zkt.NewHashFromBytes([]byte{0x12, 0x34})
+	b, err = EncodeBinaryPath(getPath(16, k[:]))
+	assert.NoError(t, err)
+	assert.Equal(t, append([]byte{16}, k[:2]...), b)
+
+	// the longest path
+	b, err = EncodeBinaryPath(make([]bool, 255))
+	assert.NoError(t, err)
+	assert.Equal(t, 33, len(b))
+	decoded, err = DecodeBinaryPath(b)
+	assert.NoError(t, err)
+	assert.Equal(t, 255, len(decoded))
+
+	_, err = EncodeBinaryPath(make([]bool, 256))
+	assert.Equal(t, ErrInvalidPath, err)
+}
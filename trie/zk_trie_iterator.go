@@ -0,0 +1,302 @@
+package trie
+
+import (
+	"errors"
+	"fmt"
+
+	zkt "github.com/scroll-tech/zktrie/types"
+)
+
+// errIteratorEnd is stored in NodeIterator.err when iteration is done
+var errIteratorEnd = errors.New("end of iteration")
+
+// MissingNodeError is returned by the iterators when a node referred by its
+// hash can not be found in the db
+type MissingNodeError struct {
+	NodeHash *zkt.Hash // hash of the missing node
+	Path     []bool    // path of the missing node from the root
+	Err      error     // the error returned by the db
+}
+
+func (err *MissingNodeError) Error() string {
+	return fmt.Sprintf("missing trie node %s (path %s): %v", err.NodeHash.Hex(), pathString(err.Path), err.Err)
+}
+
+func (err *MissingNodeError) Unwrap() error {
+	return err.Err
+}
+
+func pathString(path []bool) string {
+	b := make([]byte, len(path))
+	for i, bit := range path {
+		if bit {
+			b[i] = '1'
+		} else {
+			b[i] = '0'
+		}
+	}
+	return string(b)
+}
+
+// comparePath compares the node key a and b in path order (the LSB-first bit
+// order used by getPath), it returns -1, 0 or 1 like bytes.Compare
+func comparePath(numLevels int, a, b *zkt.Hash) int {
+	for i := 0; i < numLevels; i++ {
+		bitA, bitB := zkt.TestBit(a[:], uint(i)), zkt.TestBit(b[:], uint(i))
+		if bitA == bitB {
+			continue
+		}
+		if bitB {
+			return -1
+		}
+		return 1
+	}
+	return 0
+}
+
+type nodeIteratorFrame struct {
+	hash  *zkt.Hash
+	node  *Node // nil before the node is resolved
+	path  []bool
+	child int // index of the next child to be visited for parent node
+}
+
+// NodeIterator is a pull-style iterator which visits all the (non-empty)
+// nodes of a trie in pre-order, the children are visited in path order,
+// i.e. left child before right child. The iterator keeps all of its state
+// between calls, so caller can stop at any point and resume it later.
+//
+// When a node is missing in the db, Next returns false and Error returns a
+// *MissingNodeError, calling Next again would retry to resolve the node.
+type NodeIterator struct {
+	mt      *ZkTrieImpl
+	root    *zkt.Hash
+	stack   []*nodeIteratorFrame
+	started bool
+	err     error
+}
+
+// NewNodeIterator creates an iterator over the trie with the given root,
+// if root is nil the current root of the MT is used
+func (mt *ZkTrieImpl) NewNodeIterator(root *zkt.Hash) *NodeIterator {
+	if root == nil {
+		root = mt.rootHash
+	}
+	return &NodeIterator{mt: mt, root: root}
+}
+
+// Next moves the iterator to the next node, it returns false when the
+// iteration is finished or an error has been encountered
+func (it *NodeIterator) Next() bool {
+	if it.err != nil {
+		var missing *MissingNodeError
+		if !errors.As(it.err, &missing) {
+			return false
+		}
+		// retry resolving the missing node at the top of stack
+		it.err = nil
+	}
+
+	if !it.started {
+		it.started = true
+		if *it.root == zkt.HashZero {
+			it.err = errIteratorEnd
+			return false
+		}
+		it.stack = append(it.stack, &nodeIteratorFrame{hash: it.root})
+	} else if len(it.stack) == 0 {
+		it.err = errIteratorEnd
+		return false
+	} else if it.stack[len(it.stack)-1].node != nil && !it.advance() {
+		it.err = errIteratorEnd
+		return false
+	}
+
+	return it.resolveTop()
+}
+
+// advance pushes the next unvisited child onto the stack, popping the
+// finished frames
+func (it *NodeIterator) advance() bool {
+	for len(it.stack) > 0 {
+		top := it.stack[len(it.stack)-1]
+		if top.node.Type == NodeTypeParent && top.child < 2 {
+			right := top.child == 1
+			top.child++
+			childHash := top.node.ChildL
+			if right {
+				childHash = top.node.ChildR
+			}
+			if *childHash == zkt.HashZero {
+				continue
+			}
+			it.stack = append(it.stack, &nodeIteratorFrame{hash: childHash, path: appendPath(top.path, right)})
+			return true
+		}
+		it.stack = it.stack[:len(it.stack)-1]
+	}
+	return false
+}
+
+func (it *NodeIterator) resolveTop() bool {
+	top := it.stack[len(it.stack)-1]
+	if len(top.path) >= it.mt.maxLevels {
+		it.err = ErrReachedMaxLevel
+		return false
+	}
+	n, err := it.mt.GetNode(top.hash)
+	if err == ErrKeyNotFound {
+		it.err = &MissingNodeError{NodeHash: top.hash, Path: top.path, Err: err}
+		return false
+	} else if err != nil {
+		it.err = err
+		return false
+	}
+	top.node = n
+	return true
+}
+
+// Seek moves the iterator to the position where the next call of Next
+// yields the first leaf whose node key is not less than nodeKey in path order
+func (it *NodeIterator) Seek(nodeKey *zkt.Hash) error {
+	it.stack = nil
+	it.started = true
+	it.err = nil
+	if *it.root == zkt.HashZero {
+		it.err = errIteratorEnd
+		return nil
+	}
+
+	path := getPath(it.mt.maxLevels, nodeKey[:])
+	it.stack = append(it.stack, &nodeIteratorFrame{hash: it.root})
+	for {
+		if !it.resolveTop() {
+			return it.err
+		}
+		top := it.stack[len(it.stack)-1]
+		switch top.node.Type {
+		case NodeTypeParent:
+			right := path[len(top.path)]
+			top.child = 1
+			childHash := top.node.ChildL
+			if right {
+				top.child = 2
+				childHash = top.node.ChildR
+			}
+			if *childHash == zkt.HashZero {
+				return nil
+			}
+			it.stack = append(it.stack, &nodeIteratorFrame{hash: childHash, path: appendPath(top.path, right)})
+		case NodeTypeLeaf:
+			if comparePath(it.mt.maxLevels, top.node.NodeKey, nodeKey) < 0 {
+				// the leaf has been passed
+				return nil
+			}
+			// pop the leaf so it is visited by next call
+			it.stack = it.stack[:len(it.stack)-1]
+			if len(it.stack) == 0 {
+				it.started = false
+			} else {
+				it.stack[len(it.stack)-1].child--
+			}
+			return nil
+		default:
+			return nil
+		}
+	}
+}
+
+// Hash returns the hash of current node
+func (it *NodeIterator) Hash() *zkt.Hash {
+	if len(it.stack) == 0 {
+		return nil
+	}
+	return it.stack[len(it.stack)-1].hash
+}
+
+// Node returns current node
+func (it *NodeIterator) Node() *Node {
+	if len(it.stack) == 0 {
+		return nil
+	}
+	return it.stack[len(it.stack)-1].node
+}
+
+// Path returns the path from root to current node
+func (it *NodeIterator) Path() []bool {
+	if len(it.stack) == 0 {
+		return nil
+	}
+	return it.stack[len(it.stack)-1].path
+}
+
+// Leaf returns whether current node is a leaf node
+func (it *NodeIterator) Leaf() bool {
+	n := it.Node()
+	return n != nil && n.Type == NodeTypeLeaf
+}
+
+// Error returns the error encountered by iteration, or nil if the iteration
+// is finished normally
+func (it *NodeIterator) Error() error {
+	if it.err == errIteratorEnd {
+		return nil
+	}
+	return it.err
+}
+
+func appendPath(path []bool, bit bool) []bool {
+	ret := make([]bool, len(path)+1)
+	copy(ret, path)
+	ret[len(path)] = bit
+	return ret
+}
+
+// LeafIterator visits the leaves of a trie in path order of their node keys
+type LeafIterator struct {
+	it *NodeIterator
+}
+
+// NewLeafIterator creates a leaf iterator over the trie with the given root,
+// if root is nil the current root of the MT is used
+func (mt *ZkTrieImpl) NewLeafIterator(root *zkt.Hash) *LeafIterator {
+	return &LeafIterator{it: mt.NewNodeIterator(root)}
+}
+
+// Next moves the iterator to the next leaf
+func (it *LeafIterator) Next() bool {
+	for it.it.Next() {
+		if it.it.Leaf() {
+			return true
+		}
+	}
+	return false
+}
+
+// Seek moves the iterator so the next leaf is the first one whose key is not
+// less than nodeKey in path order. An iteration can be resumed from a different
+// iterator by seeking to the last visited key and skipping it
+func (it *LeafIterator) Seek(nodeKey *zkt.Hash) error {
+	return it.it.Seek(nodeKey)
+}
+
+// Key returns the node key of current leaf
+func (it *LeafIterator) Key() *zkt.Hash {
+	return it.it.Node().NodeKey
+}
+
+// KeyPreimage returns the original key of current leaf if it is known, see
+// ZkTrieImpl.KeyPreimage
+func (it *LeafIterator) KeyPreimage() ([]byte, bool) {
+	return it.it.mt.KeyPreimage(it.Key())
+}
+
+// Node returns current leaf node
+func (it *LeafIterator) Node() *Node {
+	return it.it.Node()
+}
+
+// Error returns the error encountered by iteration
+func (it *LeafIterator) Error() error {
+	return it.it.Error()
+}
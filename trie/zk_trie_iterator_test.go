@@ -0,0 +1,136 @@
+package trie
+
+import (
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	zkt "github.com/scroll-tech/zktrie/types"
+)
+
+func newIteratorTestingTrie(t *testing.T, num int) (*zkTrieImplTestWrapper, []*zkt.Hash) {
+	mt := newTestingMerkle(t, 10)
+	var keys []*zkt.Hash
+	for i := 0; i < num; i++ {
+		k := zkt.NewByte32FromBytes([]byte{byte(i * 7)})
+		err := mt.AddWord(k, &zkt.Byte32{byte(i)})
+		assert.NoError(t, err)
+		keys = append(keys, zkt.NewHashFromBytes(k[:]))
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return comparePath(mt.maxLevels, keys[i], keys[j]) < 0
+	})
+	return mt, keys
+}
+
+func collectLeaves(it *LeafIterator) []*zkt.Hash {
+	var ret []*zkt.Hash
+	for it.Next() {
+		ret = append(ret, it.Key())
+	}
+	return ret
+}
+
+func TestLeafIterator(t *testing.T) {
+	t.Run("Empty trie", func(t *testing.T) {
+		mt := newTestingMerkle(t, 10)
+		it := mt.NewLeafIterator(nil)
+		assert.False(t, it.Next())
+		assert.NoError(t, it.Error())
+	})
+
+	t.Run("Path order", func(t *testing.T) {
+		mt, keys := newIteratorTestingTrie(t, 20)
+		it := mt.NewLeafIterator(nil)
+		assert.Equal(t, keys, collectLeaves(it))
+		assert.NoError(t, it.Error())
+
+		nodes := 0
+		nit := mt.NewNodeIterator(nil)
+		for nit.Next() {
+			hash, err := nit.Node().NodeHash()
+			assert.NoError(t, err)
+			assert.Equal(t, nit.Hash(), hash)
+			nodes++
+		}
+		walked := 0
+		err := mt.Walk(nil, func(n *Node) {
+			if n.Type != NodeTypeEmpty {
+				walked++
+			}
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, walked, nodes)
+	})
+
+	t.Run("Seek", func(t *testing.T) {
+		mt, keys := newIteratorTestingTrie(t, 20)
+		for i, k := range keys {
+			it := mt.NewLeafIterator(nil)
+			assert.NoError(t, it.Seek(k))
+			assert.Equal(t, keys[i:], collectLeaves(it))
+		}
+
+		// seek to a key not in trie
+		it := mt.NewLeafIterator(nil)
+		missing := zkt.NewHashFromBytes([]byte{3})
+		assert.NoError(t, it.Seek(missing))
+		var expected []*zkt.Hash
+		for _, k := range keys {
+			if comparePath(mt.maxLevels, k, missing) >= 0 {
+				expected = append(expected, k)
+			}
+		}
+		assert.Equal(t, expected, collectLeaves(it))
+	})
+
+	t.Run("Pause and resume", func(t *testing.T) {
+		mt, keys := newIteratorTestingTrie(t, 20)
+		it := mt.NewLeafIterator(nil)
+		var got []*zkt.Hash
+		for i := 0; i < 5 && it.Next(); i++ {
+			got = append(got, it.Key())
+		}
+
+		resumed := mt.NewLeafIterator(nil)
+		assert.NoError(t, resumed.Seek(got[len(got)-1]))
+		assert.True(t, resumed.Next())
+		assert.Equal(t, got[len(got)-1], resumed.Key())
+
+		got = append(got, collectLeaves(it)...)
+		assert.Equal(t, keys, got)
+	})
+
+	t.Run("Missing node", func(t *testing.T) {
+		db := NewZkTrieMemoryDb()
+		mt, err := newZkTrieImpl(db, 10)
+		assert.NoError(t, err)
+		for i := 0; i < 10; i++ {
+			err := mt.AddWord(zkt.NewByte32FromBytes([]byte{byte(i)}), &zkt.Byte32{byte(i)})
+			assert.NoError(t, err)
+		}
+		_, _, err = mt.Commit()
+		assert.NoError(t, err)
+
+		root, err := mt.GetNode(mt.Root())
+		assert.NoError(t, err)
+		removed := root.ChildR
+		removedVal := db.db[string(removed[:])]
+		delete(db.db, string(removed[:]))
+
+		it := mt.NewLeafIterator(nil)
+		leaves := collectLeaves(it)
+		missingErr, ok := it.Error().(*MissingNodeError)
+		assert.True(t, ok)
+		assert.Equal(t, removed, missingErr.NodeHash)
+		assert.Equal(t, []bool{true}, missingErr.Path)
+		assert.ErrorIs(t, it.Error(), ErrKeyNotFound)
+
+		// resume after the node is available
+		db.db[string(removed[:])] = removedVal
+		leaves = append(leaves, collectLeaves(it)...)
+		assert.NoError(t, it.Error())
+		assert.Equal(t, 10, len(leaves))
+	})
+}
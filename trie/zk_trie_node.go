@@ -67,6 +67,27 @@ func NewEmptyNode() *Node {
 	return &Node{Type: NodeTypeEmpty}
 }
 
+// Copy returns a deep copy of the node, which can be modified without
+// affecting the original one. The cached hashes are kept in the copy, so a
+// copy whose content is modified must not be hashed
+func (n *Node) Copy() *Node {
+	cpy := *n
+	for _, h := range []**zkt.Hash{&cpy.ChildL, &cpy.ChildR, &cpy.NodeKey} {
+		if *h != nil {
+			v := **h
+			*h = &v
+		}
+	}
+	if n.ValuePreimage != nil {
+		cpy.ValuePreimage = append([]zkt.Byte32{}, n.ValuePreimage...)
+	}
+	if n.KeyPreimage != nil {
+		v := *n.KeyPreimage
+		cpy.KeyPreimage = &v
+	}
+	return &cpy
+}
+
 // NewNodeFromBytes creates a new node by parsing the input []byte.
 func NewNodeFromBytes(b []byte) (*Node, error) {
 	if len(b) < 1 {
@@ -118,30 +139,42 @@ func NewNodeFromBytes(b []byte) (*Node, error) {
 // LeafHash computes the key of a leaf node given the hIndex and hValue of the
 // entry of the leaf.
 func LeafHash(k, v *zkt.Hash) (*zkt.Hash, error) {
-	return zkt.HashElems(big.NewInt(1), k.BigInt(), v.BigInt())
+	return LeafHashWithHasher(zkt.DefaultHasher, k, v)
+}
+
+// LeafHashWithHasher is the same as LeafHash but use the specified hash scheme
+func LeafHashWithHasher(h zkt.Hasher, k, v *zkt.Hash) (*zkt.Hash, error) {
+	return zkt.HashElemsWithHasher(h, big.NewInt(1), k.BigInt(), v.BigInt())
 }
 
 // NodeHash computes the hash digest of the node by hashing the content in a
 // specific way for each type of node.  This key is used as the hash of the
 // Merkle tree for each node.
 func (n *Node) NodeHash() (*zkt.Hash, error) {
+	return n.NodeHashWithHasher(zkt.DefaultHasher)
+}
+
+// NodeHashWithHasher is the same as NodeHash but use the specified hash scheme.
+// Notice the result is cached in the node, so a node should always be hashed
+// by the same scheme
+func (n *Node) NodeHashWithHasher(h zkt.Hasher) (*zkt.Hash, error) {
 	if n.nodeHash == nil { // Cache the key to avoid repeated hash computations.
 		// NOTE: We are not using the type to calculate the hash!
 		switch n.Type {
 		case NodeTypeParent: // H(ChildL || ChildR)
 			var err error
-			n.nodeHash, err = zkt.HashElems(n.ChildL.BigInt(), n.ChildR.BigInt())
+			n.nodeHash, err = zkt.HashElemsWithHasher(h, n.ChildL.BigInt(), n.ChildR.BigInt())
 			if err != nil {
 				return nil, err
 			}
 		case NodeTypeLeaf:
 			var err error
-			n.valueHash, err = zkt.PreHandlingElems(n.CompressedFlags, n.ValuePreimage)
+			n.valueHash, err = zkt.PreHandlingElemsWithHasher(h, n.CompressedFlags, n.ValuePreimage)
 			if err != nil {
 				return nil, err
 			}
 
-			n.nodeHash, err = LeafHash(n.NodeKey, n.valueHash)
+			n.nodeHash, err = LeafHashWithHasher(h, n.NodeKey, n.valueHash)
 			if err != nil {
 				return nil, err
 			}
@@ -158,11 +191,22 @@ func (n *Node) NodeHash() (*zkt.Hash, error) {
 // ValueHash computes the hash digest of the value stored in the leaf node. For
 // other node types, it returns the zero hash.
 func (n *Node) ValueHash() (*zkt.Hash, error) {
+	return n.ValueHashWithHasher(zkt.DefaultHasher)
+}
+
+// ValueHashWithHasher is the same as ValueHash but use the specified hash scheme
+func (n *Node) ValueHashWithHasher(h zkt.Hasher) (*zkt.Hash, error) {
 	if n.Type != NodeTypeLeaf {
 		return &zkt.HashZero, nil
 	}
-	if _, err := n.NodeHash(); err != nil {
-		return nil, err
+	if n.valueHash == nil {
+		// the node hash may be known without hashing the value, e.g. the
+		// node is resolved from NodeCache
+		var err error
+		n.valueHash, err = zkt.PreHandlingElemsWithHasher(h, n.CompressedFlags, n.ValuePreimage)
+		if err != nil {
+			return nil, err
+		}
 	}
 	return n.valueHash, nil
 }
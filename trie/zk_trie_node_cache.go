@@ -0,0 +1,191 @@
+package trie
+
+import (
+	"container/list"
+	"math/big"
+	"sync"
+	"sync/atomic"
+
+	zkt "github.com/scroll-tech/zktrie/types"
+)
+
+// NodeCacheStats is the metrics of NodeCache
+type NodeCacheStats struct {
+	Hits   uint64
+	Misses uint64
+	// Size is the number of the cached nodes
+	Size int
+}
+
+type nodeCacheEntry struct {
+	hash zkt.Hash
+	node *Node
+}
+
+// NodeCache is a ZktrieDatabase wrapper which keeps the recently used nodes
+// decoded in a LRU cache keyed by node hash, so the frequently touched nodes
+// (e.g. the upper levels of the trie) are not fetched and parsed for every
+// lookup. The hash of a cached node is taken from its key so it is not
+// recalculated either. It is safe for concurrent use.
+//
+// Since the nodes are addressed by their hashes, the cached content never
+// gets stale. The nodes deleted by the batches of the cache are evicted once
+// the batch is written, but a node deleted from the underlying db directly may
+// still be resolved from the cache.
+type NodeCache struct {
+	db       ZktrieDatabase
+	capacity int
+
+	lock  sync.Mutex
+	items map[zkt.Hash]*list.Element
+	lru   *list.List
+
+	hits   uint64
+	misses uint64
+}
+
+// NewNodeCache wraps db with a node cache holding at most size nodes
+func NewNodeCache(db ZktrieDatabase, size int) *NodeCache {
+	return &NodeCache{
+		db:       db,
+		capacity: size,
+		items:    make(map[zkt.Hash]*list.Element),
+		lru:      list.New(),
+	}
+}
+
+func (c *NodeCache) UpdatePreimage(preimage []byte, hashField *big.Int) {
+	c.db.UpdatePreimage(preimage, hashField)
+}
+
+func (c *NodeCache) Preimage(hashField *big.Int) ([]byte, bool) {
+	return c.db.Preimage(hashField)
+}
+
+func (c *NodeCache) Put(k, v []byte) error {
+	return c.db.Put(k, v)
+}
+
+func (c *NodeCache) Get(key []byte) ([]byte, error) {
+	return c.db.Get(key)
+}
+
+// GetNode returns the decoded node with nodeHash, from the cache if possible.
+// The returned node is a copy so caller can modify it
+func (c *NodeCache) GetNode(nodeHash *zkt.Hash) (*Node, error) {
+	c.lock.Lock()
+	if elem, ok := c.items[*nodeHash]; ok {
+		c.lru.MoveToFront(elem)
+		cpy := elem.Value.(*nodeCacheEntry).node.Copy()
+		c.lock.Unlock()
+		atomic.AddUint64(&c.hits, 1)
+		return cpy, nil
+	}
+	c.lock.Unlock()
+	atomic.AddUint64(&c.misses, 1)
+
+	nBytes, err := c.db.Get(nodeHash[:])
+	if err != nil {
+		return nil, err
+	}
+	n, err := NewNodeFromBytes(nBytes)
+	if err != nil {
+		return nil, err
+	}
+	if n.Type != NodeTypeEmpty {
+		h := *nodeHash
+		n.nodeHash = &h
+	}
+	c.add(*nodeHash, n)
+	return n.Copy(), nil
+}
+
+func (c *NodeCache) add(nodeHash zkt.Hash, n *Node) {
+	if c.capacity <= 0 {
+		return
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if elem, ok := c.items[nodeHash]; ok {
+		c.lru.MoveToFront(elem)
+		return
+	}
+	c.items[nodeHash] = c.lru.PushFront(&nodeCacheEntry{hash: nodeHash, node: n})
+	for c.lru.Len() > c.capacity {
+		oldest := c.lru.Back()
+		c.lru.Remove(oldest)
+		delete(c.items, oldest.Value.(*nodeCacheEntry).hash)
+	}
+}
+
+// evict removes the node from the cache
+func (c *NodeCache) evict(nodeHash zkt.Hash) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if elem, ok := c.items[nodeHash]; ok {
+		c.lru.Remove(elem)
+		delete(c.items, nodeHash)
+	}
+}
+
+// Stats returns the metrics of the cache
+func (c *NodeCache) Stats() NodeCacheStats {
+	c.lock.Lock()
+	size := c.lru.Len()
+	c.lock.Unlock()
+
+	return NodeCacheStats{
+		Hits:   atomic.LoadUint64(&c.hits),
+		Misses: atomic.LoadUint64(&c.misses),
+		Size:   size,
+	}
+}
+
+// NewBatch creates a batch of the underlying db, the nodes deleted by the batch
+// are evicted from the cache when it is written. If the underlying db does not
+// implement Batcher, the writes of the batch are put into the db one by one
+// when Write is called and deletion is not supported
+func (c *NodeCache) NewBatch() Batch {
+	if batcher, ok := c.db.(Batcher); ok {
+		return &nodeCacheBatch{Batch: batcher.NewBatch(), cache: c}
+	}
+	return &putBatch{db: c.db}
+}
+
+// nodeCacheBatch is a batch of the underlying db which evicts the deleted
+// nodes from the cache
+type nodeCacheBatch struct {
+	Batch
+	cache   *NodeCache
+	deletes []zkt.Hash
+}
+
+func (b *nodeCacheBatch) Delete(k []byte) error {
+	if err := b.Batch.Delete(k); err != nil {
+		return err
+	}
+	if len(k) == zkt.HashByteLen {
+		var nodeHash zkt.Hash
+		copy(nodeHash[:], k)
+		b.deletes = append(b.deletes, nodeHash)
+	}
+	return nil
+}
+
+func (b *nodeCacheBatch) Write() error {
+	if err := b.Batch.Write(); err != nil {
+		return err
+	}
+	for _, nodeHash := range b.deletes {
+		b.cache.evict(nodeHash)
+	}
+	return nil
+}
+
+func (b *nodeCacheBatch) Reset() {
+	b.Batch.Reset()
+	b.deletes = b.deletes[:0]
+}
@@ -0,0 +1,152 @@
+package trie
+
+import (
+	"math/big"
+	"sync"
+	"testing"
+
+	zkt "github.com/scroll-tech/zktrie/types"
+	"github.com/stretchr/testify/assert"
+)
+
+// putOnlyDb is a db which does not implement Batcher
+type putOnlyDb struct {
+	db *Database
+}
+
+func (db putOnlyDb) UpdatePreimage([]byte, *big.Int) {}
+
+func (db putOnlyDb) Preimage(hashField *big.Int) ([]byte, bool) { return db.db.Preimage(hashField) }
+
+func (db putOnlyDb) Put(k, v []byte) error { return db.db.Put(k, v) }
+
+func (db putOnlyDb) Get(key []byte) ([]byte, error) { return db.db.Get(key) }
+
+func TestNodeCache(t *testing.T) {
+	memDb := NewZkTrieMemoryDb()
+	cache := NewNodeCache(memDb, 16)
+
+	mt, err := NewZkTrieImpl(cache, NodeKeyValidBytes*8)
+	assert.NoError(t, err)
+	for i := 0; i < 32; i++ {
+		assert.NoError(t, mt.TryUpdate(zkt.NewHashFromBytes([]byte{byte(i + 1)}), 1, []zkt.Byte32{{byte(i)}}))
+	}
+	root, _, err := mt.Commit()
+	assert.NoError(t, err)
+
+	mt, err = NewZkTrieImplWithRoot(cache, root, NodeKeyValidBytes*8)
+	assert.NoError(t, err)
+	for round := 0; round < 2; round++ {
+		for i := 0; i < 32; i++ {
+			node, err := mt.GetLeafNode(zkt.NewHashFromBytes([]byte{byte(i + 1)}))
+			assert.NoError(t, err)
+			assert.Equal(t, zkt.Byte32{byte(i)}, node.ValuePreimage[0])
+		}
+	}
+	stats := cache.Stats()
+	assert.Equal(t, 16, stats.Size)
+	assert.Greater(t, stats.Hits, uint64(0))
+	assert.Greater(t, stats.Misses, uint64(0))
+
+	// the node resolved from cache has the same hash and value hash
+	for i := 0; i < 32; i++ {
+		k := zkt.NewHashFromBytes([]byte{byte(i + 1)})
+		cached, err := mt.GetLeafNode(k)
+		assert.NoError(t, err)
+		expected := NewLeafNode(k, 1, []zkt.Byte32{{byte(i)}})
+		expectedHash, err := expected.NodeHash()
+		assert.NoError(t, err)
+		cachedHash, err := cached.NodeHash()
+		assert.NoError(t, err)
+		assert.Equal(t, expectedHash, cachedHash)
+		expectedValueHash, err := expected.ValueHash()
+		assert.NoError(t, err)
+		cachedValueHash, err := cached.ValueHash()
+		assert.NoError(t, err)
+		assert.Equal(t, expectedValueHash, cachedValueHash)
+
+		proof, node, err := BuildZkTrieProof(root, k.BigInt(), NodeKeyValidBytes*8, mt.GetNode)
+		assert.NoError(t, err)
+		assert.True(t, VerifyProofZkTrie(root, proof, node))
+	}
+
+	// modifying the returned node does not affect the cached one
+	rootNode, err := mt.GetNode(root)
+	assert.NoError(t, err)
+	rootNode.ChildL = &zkt.HashZero
+	rootNode, err = mt.GetNode(root)
+	assert.NoError(t, err)
+	assert.NotEqual(t, &zkt.HashZero, rootNode.ChildL)
+
+	_, err = cache.GetNode(zkt.NewHashFromBytes([]byte{1}))
+	assert.Equal(t, ErrKeyNotFound, err)
+}
+
+func TestNodeCache_Concurrent(t *testing.T) {
+	cache := NewNodeCache(NewZkTrieMemoryDb(), 8)
+	mt, err := NewZkTrieImpl(cache, NodeKeyValidBytes*8)
+	assert.NoError(t, err)
+	for i := 0; i < 64; i++ {
+		assert.NoError(t, mt.TryUpdate(zkt.NewHashFromBytes([]byte{byte(i + 1)}), 1, []zkt.Byte32{{byte(i)}}))
+	}
+	root, _, err := mt.Commit()
+	assert.NoError(t, err)
+
+	var wg sync.WaitGroup
+	for w := 0; w < 4; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			reader, err := NewZkTrieImplWithRoot(cache, root, NodeKeyValidBytes*8)
+			assert.NoError(t, err)
+			for i := 0; i < 64; i++ {
+				node, err := reader.GetLeafNode(zkt.NewHashFromBytes([]byte{byte(i + 1)}))
+				assert.NoError(t, err)
+				assert.Equal(t, zkt.Byte32{byte(i)}, node.ValuePreimage[0])
+			}
+		}()
+	}
+	wg.Wait()
+	assert.LessOrEqual(t, cache.Stats().Size, 8)
+}
+
+func TestNodeCache_PutBatch(t *testing.T) {
+	memDb := NewZkTrieMemoryDb()
+	cache := NewNodeCache(putOnlyDb{memDb}, 8)
+
+	mt, err := NewZkTrieImpl(cache, NodeKeyValidBytes*8)
+	assert.NoError(t, err)
+	for i := 0; i < 8; i++ {
+		assert.NoError(t, mt.TryUpdate(zkt.NewHashFromBytes([]byte{byte(i + 1)}), 1, []zkt.Byte32{{byte(i)}}))
+	}
+	_, set, err := mt.Commit()
+	assert.NoError(t, err)
+	assert.Equal(t, set.Len()+1, len(memDb.db))
+
+	batch := cache.NewBatch()
+	assert.Equal(t, ErrDeleteNotSupported, batch.Delete([]byte("key")))
+}
+
+func TestNodeCache_BatchDelete(t *testing.T) {
+	memDb := NewZkTrieMemoryDb()
+	cache := NewNodeCache(memDb, 8)
+
+	mt, err := NewZkTrieImpl(cache, NodeKeyValidBytes*8)
+	assert.NoError(t, err)
+	assert.NoError(t, mt.TryUpdate(zkt.NewHashFromBytes([]byte{1}), 1, []zkt.Byte32{{1}}))
+	_, _, err = mt.Commit()
+	assert.NoError(t, err)
+	root := mt.Root()
+	_, err = cache.GetNode(root)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, cache.Stats().Size)
+
+	batch := cache.NewBatch()
+	assert.NoError(t, batch.Delete(root[:]))
+	// evicted only when the batch is written
+	assert.Equal(t, 1, cache.Stats().Size)
+	assert.NoError(t, batch.Write())
+	assert.Equal(t, 0, cache.Stats().Size)
+	_, err = cache.GetNode(root)
+	assert.Equal(t, ErrKeyNotFound, err)
+}
@@ -2,6 +2,8 @@ package trie
 
 import (
 	"bytes"
+	"encoding/json"
+	"fmt"
 
 	zkt "github.com/scroll-tech/zktrie/types"
 )
@@ -77,3 +79,307 @@ func (mt *ZkTrieImpl) prove(kHash *zkt.Hash, fromLevel uint, writeNode func(*Nod
 
 	return nil
 }
+
+const (
+	// proofFlagNonExistence is set in the first header byte for non-existence proof
+	proofFlagNonExistence byte = 0x01
+	// proofFlagNodeAux is set in the first header byte if the proof has NodeAux
+	proofFlagNodeAux byte = 0x02
+	// proofMaxDepth is the maximum depth can be recorded in notempties
+	proofMaxDepth = (zkt.HashByteLen - proofFlagsLen) * 8
+)
+
+// Depth returns how deep in the tree the proof goes
+func (proof *Proof) Depth() uint {
+	return proof.depth
+}
+
+// AllSiblings returns all the siblings of the proof, including the empty ones
+func (proof *Proof) AllSiblings() []*zkt.Hash {
+	var siblings []*zkt.Hash
+	sibIdx := 0
+	for lvl := uint(0); lvl < proof.depth; lvl++ {
+		if zkt.TestBitBigEndian(proof.notempties[:], lvl) {
+			siblings = append(siblings, proof.Siblings[sibIdx])
+			sibIdx++
+		} else {
+			siblings = append(siblings, &zkt.HashZero)
+		}
+	}
+	return siblings
+}
+
+// MarshalBinary encodes the proof as a 32 bytes header (2 bytes flags and
+// depth, and 30 bytes bitmap of non-empty siblings), followed by the non-empty
+// siblings and the key and value hash of NodeAux if exists, all the hashes are
+// encoded in big-endian
+func (proof *Proof) MarshalBinary() ([]byte, error) {
+	if proof.depth > proofMaxDepth || len(proof.Siblings) > int(proof.depth) {
+		return nil, ErrInvalidProofBytes
+	}
+	bsLen := zkt.HashByteLen * (1 + len(proof.Siblings))
+	if proof.NodeAux != nil {
+		bsLen += 2 * zkt.HashByteLen
+	}
+	bs := make([]byte, 0, bsLen)
+
+	var flags byte
+	if !proof.Existence {
+		flags |= proofFlagNonExistence
+	}
+	if proof.NodeAux != nil {
+		flags |= proofFlagNodeAux
+	}
+	bs = append(bs, flags, byte(proof.depth))
+	bs = append(bs, proof.notempties[:]...)
+	for _, sib := range proof.Siblings {
+		bs = append(bs, sib.Bytes()...)
+	}
+	if proof.NodeAux != nil {
+		bs = append(bs, proof.NodeAux.Key.Bytes()...)
+		bs = append(bs, proof.NodeAux.Value.Bytes()...)
+	}
+	return bs, nil
+}
+
+// UnmarshalBinary decodes the bytes encoded by MarshalBinary, any malformed
+// input is rejected with ErrInvalidProofBytes
+func (proof *Proof) UnmarshalBinary(bs []byte) error {
+	if len(bs) < zkt.HashByteLen || len(bs)%zkt.HashByteLen != 0 {
+		return ErrInvalidProofBytes
+	}
+	flags := bs[0]
+	if flags&^(proofFlagNonExistence|proofFlagNodeAux) != 0 {
+		return ErrInvalidProofBytes
+	}
+	existence := flags&proofFlagNonExistence == 0
+	hasNodeAux := flags&proofFlagNodeAux != 0
+	if existence && hasNodeAux {
+		return ErrInvalidProofBytes
+	}
+
+	p := Proof{Existence: existence, depth: uint(bs[1])}
+	if p.depth > proofMaxDepth {
+		return ErrInvalidProofBytes
+	}
+	copy(p.notempties[:], bs[proofFlagsLen:zkt.HashByteLen])
+	// bits beyond the depth must not be set
+	for lvl := p.depth; lvl < proofMaxDepth; lvl++ {
+		if zkt.TestBitBigEndian(p.notempties[:], lvl) {
+			return ErrInvalidProofBytes
+		}
+	}
+
+	hashes, err := decodeProofHashes(bs[zkt.HashByteLen:])
+	if err != nil {
+		return err
+	}
+	if hasNodeAux {
+		if len(hashes) < 2 {
+			return ErrInvalidProofBytes
+		}
+		p.NodeAux = &NodeAux{Key: hashes[len(hashes)-2], Value: hashes[len(hashes)-1]}
+		hashes = hashes[:len(hashes)-2]
+	}
+
+	sibCount := 0
+	for lvl := uint(0); lvl < p.depth; lvl++ {
+		if zkt.TestBitBigEndian(p.notempties[:], lvl) {
+			sibCount++
+		}
+	}
+	if sibCount != len(hashes) {
+		return ErrInvalidProofBytes
+	}
+	for _, h := range hashes {
+		if *h == zkt.HashZero {
+			return ErrInvalidProofBytes
+		}
+	}
+	p.Siblings = hashes
+
+	*proof = p
+	return nil
+}
+
+func decodeProofHashes(bs []byte) ([]*zkt.Hash, error) {
+	hashes := make([]*zkt.Hash, 0, len(bs)/zkt.HashByteLen)
+	for i := 0; i < len(bs); i += zkt.HashByteLen {
+		h := zkt.NewHashFromBytes(bs[i : i+zkt.HashByteLen])
+		if !zkt.CheckBigIntInField(h.BigInt()) {
+			return nil, ErrInvalidProofBytes
+		}
+		hashes = append(hashes, h)
+	}
+	return hashes, nil
+}
+
+// NewProofFromBytes decodes a proof encoded by MarshalBinary
+func NewProofFromBytes(bs []byte) (*Proof, error) {
+	p := new(Proof)
+	if err := p.UnmarshalBinary(bs); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+type nodeAuxJSON struct {
+	Key   *zkt.Hash `json:"key"`
+	Value *zkt.Hash `json:"value"`
+}
+
+type proofJSON struct {
+	Existence bool         `json:"existence"`
+	Siblings  []*zkt.Hash  `json:"siblings"`
+	NodeAux   *nodeAuxJSON `json:"node_aux,omitempty"`
+}
+
+// MarshalJSON encodes the proof as json, the siblings are all the siblings
+// including the empty ones so the depth of proof is implied, and the hashes
+// are encoded as decimal strings
+func (proof *Proof) MarshalJSON() ([]byte, error) {
+	if proof.depth > proofMaxDepth || len(proof.Siblings) > int(proof.depth) {
+		return nil, ErrInvalidProofBytes
+	}
+	obj := proofJSON{
+		Existence: proof.Existence,
+		Siblings:  proof.AllSiblings(),
+	}
+	if obj.Siblings == nil {
+		obj.Siblings = []*zkt.Hash{}
+	}
+	if proof.NodeAux != nil {
+		obj.NodeAux = &nodeAuxJSON{Key: proof.NodeAux.Key, Value: proof.NodeAux.Value}
+	}
+	return json.Marshal(obj)
+}
+
+// UnmarshalJSON decodes the proof encoded by MarshalJSON, any malformed input
+// is rejected with ErrInvalidProofBytes
+func (proof *Proof) UnmarshalJSON(b []byte) error {
+	var obj proofJSON
+	if err := json.Unmarshal(b, &obj); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidProofBytes, err)
+	}
+	if len(obj.Siblings) > proofMaxDepth {
+		return ErrInvalidProofBytes
+	}
+
+	p := Proof{Existence: obj.Existence, depth: uint(len(obj.Siblings))}
+	for lvl, sib := range obj.Siblings {
+		if sib == nil || !zkt.CheckBigIntInField(sib.BigInt()) {
+			return ErrInvalidProofBytes
+		}
+		if *sib != zkt.HashZero {
+			zkt.SetBitBigEndian(p.notempties[:], uint(lvl))
+			p.Siblings = append(p.Siblings, sib)
+		}
+	}
+	if obj.NodeAux != nil {
+		if p.Existence || obj.NodeAux.Key == nil || obj.NodeAux.Value == nil ||
+			!zkt.CheckBigIntInField(obj.NodeAux.Key.BigInt()) ||
+			!zkt.CheckBigIntInField(obj.NodeAux.Value.BigInt()) {
+			return ErrInvalidProofBytes
+		}
+		p.NodeAux = &NodeAux{Key: obj.NodeAux.Key, Value: obj.NodeAux.Value}
+	}
+
+	*proof = p
+	return nil
+}
+
+// proveMulti constructs a merkle proof for multiple keys, each node on the
+// paths of the keys is written only once even it is shared by many keys
+func (mt *ZkTrieImpl) proveMulti(kHashes []*zkt.Hash, writeNode func(*Node) error) error {
+	written := make(map[zkt.Hash]*Node)
+	for _, kHash := range kHashes {
+		path := getPath(mt.maxLevels, kHash[:])
+		tn := mt.rootHash
+		for i := 0; i < mt.maxLevels; i++ {
+			n, ok := written[*tn]
+			if !ok {
+				var err error
+				n, err = mt.GetNode(tn)
+				if err != nil {
+					return err
+				}
+				if err := writeNode(n); err != nil {
+					return err
+				}
+				written[*tn] = n
+			}
+
+			if n.Type == NodeTypeParent {
+				if path[i] {
+					tn = n.ChildR
+				} else {
+					tn = n.ChildL
+				}
+				continue
+			} else if n.Type != NodeTypeEmpty && n.Type != NodeTypeLeaf {
+				return ErrInvalidNodeFound
+			}
+			break
+		}
+	}
+	return nil
+}
+
+// VerifyMultiProof checks the nodes of a proof generated by ProveMulti against
+// the root. For each key, it returns the leaf node of the key, or nil if the
+// proof shows the key is not existed
+func VerifyMultiProof(rootHash *zkt.Hash, keys [][]byte, nodes []*Node) ([]*Node, error) {
+	return VerifyMultiProofWithHasher(zkt.DefaultHasher, rootHash, keys, nodes)
+}
+
+// VerifyMultiProofWithHasher is the same as VerifyMultiProof but use the specified hash scheme
+func VerifyMultiProofWithHasher(h zkt.Hasher, rootHash *zkt.Hash, keys [][]byte, nodes []*Node) ([]*Node, error) {
+	proofDb := make(map[zkt.Hash]*Node, len(nodes))
+	for _, n := range nodes {
+		nodeHash, err := n.NodeHashWithHasher(h)
+		if err != nil {
+			return nil, err
+		}
+		proofDb[*nodeHash] = n
+	}
+
+	maxLevels := NodeKeyValidBytes * 8
+	ret := make([]*Node, len(keys))
+	for i, key := range keys {
+		k, err := zkt.NewHashFromCheckedBytes(key)
+		if err != nil {
+			return nil, err
+		}
+		path := getPath(maxLevels, k[:])
+		nextHash := rootHash
+	walk:
+		for lvl := 0; ; lvl++ {
+			if lvl >= maxLevels {
+				return nil, ErrReachedMaxLevel
+			}
+			if *nextHash == zkt.HashZero {
+				break
+			}
+			n, ok := proofDb[*nextHash]
+			if !ok {
+				return nil, &MissingNodeError{NodeHash: nextHash, Path: path[:lvl], Err: ErrKeyNotFound}
+			}
+			switch n.Type {
+			case NodeTypeParent:
+				if path[lvl] {
+					nextHash = n.ChildR
+				} else {
+					nextHash = n.ChildL
+				}
+			case NodeTypeLeaf:
+				if bytes.Equal(n.NodeKey[:], k[:]) {
+					ret[i] = n
+				}
+				break walk
+			default:
+				return nil, ErrInvalidNodeFound
+			}
+		}
+	}
+	return ret, nil
+}
@@ -1,6 +1,9 @@
 package trie
 
 import (
+	"bytes"
+	"encoding/json"
+	"math/big"
 	"testing"
 
 	zkt "github.com/scroll-tech/zktrie/types"
@@ -20,3 +23,98 @@ func TestDecodeSMTProof(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Equal(t, origNode.Value(), node.Value())
 }
+
+func TestProofMarshal(t *testing.T) {
+	mt := newTestingMerkle(t, 10)
+	for _, k := range []byte{1, 3, 5, 7, 9} {
+		err := mt.AddWord(zkt.NewByte32FromBytes([]byte{k}), &zkt.Byte32{k})
+		assert.NoError(t, err)
+	}
+
+	for _, tc := range []struct {
+		key        int64
+		existence  bool
+		hasNodeAux bool
+	}{
+		{7, true, false},
+		{11, false, true},
+		{0, false, false},
+	} {
+		proof, node, err := BuildZkTrieProof(mt.Root(), big.NewInt(tc.key), mt.MaxLevels(), mt.GetNode)
+		assert.NoError(t, err)
+		assert.Equal(t, tc.existence, proof.Existence)
+		assert.Equal(t, tc.hasNodeAux, proof.NodeAux != nil)
+		kHash := zkt.NewHashFromBigInt(big.NewInt(tc.key))
+		expectedRoot, err := proof.Verify(node.nodeHash, kHash)
+		assert.NoError(t, err)
+		assert.Equal(t, mt.Root(), expectedRoot)
+
+		b, err := proof.MarshalBinary()
+		assert.NoError(t, err)
+		decoded, err := NewProofFromBytes(b)
+		assert.NoError(t, err)
+		assert.Equal(t, proof, decoded)
+		root, err := decoded.Verify(node.nodeHash, kHash)
+		assert.NoError(t, err)
+		assert.Equal(t, mt.Root(), root)
+		if tc.existence {
+			assert.True(t, VerifyProofZkTrie(mt.Root(), decoded, node))
+		}
+
+		j, err := json.Marshal(proof)
+		assert.NoError(t, err)
+		decoded = new(Proof)
+		assert.NoError(t, json.Unmarshal(j, decoded))
+		assert.Equal(t, proof, decoded)
+		assert.Equal(t, int(proof.Depth()), len(decoded.AllSiblings()))
+	}
+}
+
+func TestProofUnmarshalInvalid(t *testing.T) {
+	mt := newTestingMerkle(t, 10)
+	for _, k := range []byte{1, 3, 5, 7, 9} {
+		err := mt.AddWord(zkt.NewByte32FromBytes([]byte{k}), &zkt.Byte32{k})
+		assert.NoError(t, err)
+	}
+	proof, _, err := BuildZkTrieProof(mt.Root(), big.NewInt(11), mt.MaxLevels(), mt.GetNode)
+	assert.NoError(t, err)
+	valid, err := proof.MarshalBinary()
+	assert.NoError(t, err)
+
+	modify := func(f func(b []byte) []byte) []byte {
+		b := make([]byte, len(valid))
+		copy(b, valid)
+		return f(b)
+	}
+
+	for _, b := range [][]byte{
+		nil,
+		valid[:31],
+		valid[:len(valid)-1],
+		valid[:len(valid)-32],
+		append(valid, make([]byte, 32)...),
+		modify(func(b []byte) []byte { b[0] = 0x04; return b }),
+		modify(func(b []byte) []byte { b[0] = 0x02; return b }),
+		modify(func(b []byte) []byte { b[1] = 241; return b }),
+		modify(func(b []byte) []byte { b[1] = 1; return b }),
+		modify(func(b []byte) []byte { b[proofFlagsLen] = 0x80; return b }),
+		modify(func(b []byte) []byte {
+			copy(b[32:64], bytes.Repeat([]byte{0xff}, 32))
+			return b
+		}),
+	} {
+		_, err := NewProofFromBytes(b)
+		assert.Equal(t, ErrInvalidProofBytes, err)
+	}
+
+	for _, j := range []string{
+		`{"existence":true,"siblings":["abc"]}`,
+		`{"existence":true,"siblings":[null]}`,
+		`{"existence":true,"siblings":[],"node_aux":{"key":"1","value":"2"}}`,
+		`{"existence":false,"siblings":[],"node_aux":{"key":"1"}}`,
+		`{"existence":false,"siblings":["21888242871839275222246405745257275088548364400416034343698204186575808495617"]}`,
+	} {
+		err := json.Unmarshal([]byte(j), new(Proof))
+		assert.ErrorIs(t, err, ErrInvalidProofBytes, j)
+	}
+}
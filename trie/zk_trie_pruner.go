@@ -0,0 +1,144 @@
+package trie
+
+import (
+	zkt "github.com/scroll-tech/zktrie/types"
+)
+
+// PrunableDatabase is a ZktrieDatabase which can be pruned, i.e. it
+// supports both batch writes and iteration
+type PrunableDatabase interface {
+	BatchDatabase
+	Iteratee
+}
+
+// PruneStats is the result of Prune
+type PruneStats struct {
+	// Retained is the number of nodes reachable from the retained roots
+	Retained int
+	// Deleted is the number of node entries deleted (or would be deleted in
+	// dry-run mode)
+	Deleted int
+	// DeletedBytes is the total size of keys and values of the deleted entries
+	DeletedBytes uint64
+}
+
+// Prune deletes all the node entries in db which are not reachable from the
+// retained roots, the other entries (e.g. the current root) are kept. All the
+// retained roots must be complete, or a *MissingNodeError is returned before
+// anything is deleted. In dry-run mode, the stats are collected without any
+// deletion.
+//
+// A node entry is told apart by its shape only: a 32 bytes key with a value
+// decoded as a parent or leaf node, the hash is not recalculated. So the db
+// must be dedicated to the tries whose roots are retained, the nodes of any
+// other trie (or any other data in the same shape) sharing the db would be
+// deleted.
+//
+// Prune is designed to be run offline, the db must not be written by others
+// while pruning. For FileDatabase, the space is reclaimed after Compact
+func Prune(db PrunableDatabase, roots []*zkt.Hash, dryRun bool) (*PruneStats, error) {
+	marked, err := markNodes(db, roots)
+	if err != nil {
+		return nil, err
+	}
+
+	stats := &PruneStats{Retained: len(marked)}
+	var sweep [][]byte
+	err = db.ForEach(func(k, v []byte) error {
+		if len(k) != zkt.HashByteLen {
+			return nil
+		}
+		// the node is stored under the raw bytes of its hash
+		var nodeHash zkt.Hash
+		copy(nodeHash[:], k)
+		if _, ok := marked[nodeHash]; ok {
+			return nil
+		}
+		if !isNodeEntry(v) {
+			return nil
+		}
+		stats.Deleted++
+		stats.DeletedBytes += uint64(len(k) + len(v))
+		sweep = append(sweep, append([]byte{}, k...))
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if dryRun {
+		return stats, nil
+	}
+
+	batch := db.NewBatch()
+	for _, k := range sweep {
+		if err := batch.Delete(k); err != nil {
+			return nil, err
+		}
+		if batch.ValueSize() >= idealBatchSize {
+			if err := batch.Write(); err != nil {
+				return nil, err
+			}
+			batch.Reset()
+		}
+	}
+	if err := batch.Write(); err != nil {
+		return nil, err
+	}
+	return stats, nil
+}
+
+// isNodeEntry reports whether v is an encoded parent or leaf node
+func isNodeEntry(v []byte) bool {
+	n, err := NewNodeFromBytes(v)
+	return err == nil && (n.Type == NodeTypeParent || n.Type == NodeTypeLeaf)
+}
+
+// markNodes collects the hashes of all the nodes reachable from roots
+func markNodes(db ZktrieDatabase, roots []*zkt.Hash) (map[zkt.Hash]struct{}, error) {
+	mt, err := NewZkTrieImpl(db, NodeKeyValidBytes*8)
+	if err != nil {
+		return nil, err
+	}
+
+	marked := make(map[zkt.Hash]struct{})
+
+	type markItem struct {
+		hash *zkt.Hash
+		path []bool
+	}
+	for _, root := range roots {
+		stack := []markItem{{hash: root}}
+		for len(stack) > 0 {
+			item := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			if *item.hash == zkt.HashZero {
+				continue
+			}
+			if _, ok := marked[*item.hash]; ok {
+				continue
+			}
+			if len(item.path) > mt.maxLevels {
+				return nil, ErrReachedMaxLevel
+			}
+
+			n, err := mt.GetNode(item.hash)
+			if err == ErrKeyNotFound {
+				return nil, &MissingNodeError{NodeHash: item.hash, Path: item.path, Err: err}
+			} else if err != nil {
+				return nil, err
+			}
+			switch n.Type {
+			case NodeTypeParent:
+				stack = append(stack,
+					markItem{hash: n.ChildR, path: appendPath(item.path, true)},
+					markItem{hash: n.ChildL, path: appendPath(item.path, false)},
+				)
+			case NodeTypeLeaf:
+			default:
+				return nil, ErrInvalidNodeFound
+			}
+			marked[*item.hash] = struct{}{}
+		}
+	}
+	return marked, nil
+}
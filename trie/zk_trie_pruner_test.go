@@ -0,0 +1,146 @@
+package trie
+
+import (
+	"errors"
+	"testing"
+
+	zkt "github.com/scroll-tech/zktrie/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPrune(t *testing.T) {
+	db := NewZkTrieMemoryDb()
+	zkTrie, err := NewZkTrie(zkt.Byte32{}, db)
+	assert.NoError(t, err)
+
+	var roots []*zkt.Hash
+	for round := 0; round < 3; round++ {
+		for i := 0; i < 16; i++ {
+			key := make([]byte, 32)
+			key[31] = byte(i + 1)
+			assert.NoError(t, zkTrie.TryUpdate(key, 1, []zkt.Byte32{{byte(round), byte(i)}}))
+		}
+		root, _, err := zkTrie.Commit()
+		assert.NoError(t, err)
+		roots = append(roots, root)
+	}
+
+	total := len(db.db)
+	retained := []*zkt.Hash{roots[0], roots[2]}
+
+	stats, err := Prune(db, retained, true)
+	assert.NoError(t, err)
+	assert.Greater(t, stats.Deleted, 0)
+	assert.Greater(t, stats.DeletedBytes, uint64(0))
+	// nothing is deleted in dry-run mode
+	assert.Equal(t, total, len(db.db))
+
+	pruned, err := Prune(db, retained, false)
+	assert.NoError(t, err)
+	assert.Equal(t, stats, pruned)
+	// the retained nodes and the current root entry
+	assert.Equal(t, stats.Retained+1, len(db.db))
+	assert.Equal(t, total-stats.Deleted, len(db.db))
+
+	for round, root := range retained {
+		zkTrie, err := NewZkTrie(*zkt.NewByte32FromBytes(root.Bytes()), db)
+		assert.NoError(t, err)
+		for i := 0; i < 16; i++ {
+			key := make([]byte, 32)
+			key[31] = byte(i + 1)
+			value, err := zkTrie.TryGet(key)
+			assert.NoError(t, err)
+			assert.Equal(t, (&zkt.Byte32{byte(round * 2), byte(i)}).Bytes(), value)
+		}
+	}
+	_, err = NewZkTrie(*zkt.NewByte32FromBytes(roots[1].Bytes()), db)
+	assert.Equal(t, ErrKeyNotFound, err)
+
+	// pruning again deletes nothing
+	stats, err = Prune(db, retained, false)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, stats.Deleted)
+
+	// refuse to prune with an incomplete root
+	_, err = Prune(db, []*zkt.Hash{roots[1]}, false)
+	var missing *MissingNodeError
+	assert.True(t, errors.As(err, &missing))
+	assert.Equal(t, roots[1], missing.NodeHash)
+	assert.Equal(t, stats.Retained+1, len(db.db))
+}
+
+func TestPrune_FileDatabase(t *testing.T) {
+	dir := t.TempDir()
+	db, err := NewZkTrieFileDb(dir, nil)
+	assert.NoError(t, err)
+	zkTrie, err := NewZkTrie(zkt.Byte32{}, db)
+	assert.NoError(t, err)
+
+	var root *zkt.Hash
+	for round := 0; round < 3; round++ {
+		for i := 0; i < 16; i++ {
+			key := make([]byte, 32)
+			key[31] = byte(i + 1)
+			assert.NoError(t, zkTrie.TryUpdate(key, 1, []zkt.Byte32{{byte(round), byte(i)}}))
+		}
+		root, _, err = zkTrie.Commit()
+		assert.NoError(t, err)
+	}
+
+	stats, err := Prune(db, []*zkt.Hash{root}, false)
+	assert.NoError(t, err)
+	assert.Greater(t, stats.Deleted, 0)
+	assert.NoError(t, db.Compact())
+	assert.NoError(t, db.Close())
+
+	db, err = NewZkTrieFileDb(dir, nil)
+	assert.NoError(t, err)
+	entries := 0
+	assert.NoError(t, db.ForEach(func(k, v []byte) error {
+		entries++
+		return nil
+	}))
+	assert.Equal(t, stats.Retained+1, entries)
+
+	zkTrie, err = NewZkTrie(*zkt.NewByte32FromBytes(root.Bytes()), db)
+	assert.NoError(t, err)
+	for i := 0; i < 16; i++ {
+		key := make([]byte, 32)
+		key[31] = byte(i + 1)
+		value, err := zkTrie.TryGet(key)
+		assert.NoError(t, err)
+		assert.Equal(t, (&zkt.Byte32{2, byte(i)}).Bytes(), value)
+	}
+	assert.NoError(t, db.Close())
+}
+
+func TestPrune_ForeignEntries(t *testing.T) {
+	db := NewZkTrieMemoryDb()
+	zkTrie, err := NewZkTrie(zkt.Byte32{}, db)
+	assert.NoError(t, err)
+	key := make([]byte, 32)
+	key[31] = 1
+	assert.NoError(t, zkTrie.TryUpdate(key, 1, []zkt.Byte32{{1}}))
+	root, _, err := zkTrie.Commit()
+	assert.NoError(t, err)
+
+	// the entries not in the shape of a node are not owned by the trie
+	leaf, err := db.Get(root[:])
+	assert.NoError(t, err)
+	foreign := make([]byte, zkt.HashByteLen)
+	foreign[0] = 0xff
+	assert.NoError(t, db.Put(foreign, []byte("not a node")))
+	assert.NoError(t, db.Put([]byte("leaf"), leaf))
+
+	stats, err := Prune(db, nil, false)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, stats.Deleted)
+	_, err = db.Get(root[:])
+	assert.Equal(t, ErrKeyNotFound, err)
+	value, err := db.Get(foreign)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("not a node"), value)
+	value, err = db.Get([]byte("leaf"))
+	assert.NoError(t, err)
+	assert.Equal(t, leaf, value)
+}
@@ -0,0 +1,214 @@
+package trie
+
+import (
+	"bytes"
+	"errors"
+
+	zkt "github.com/scroll-tech/zktrie/types"
+)
+
+// ErrInvalidRangeProof is used when a range proof can not be verified
+var ErrInvalidRangeProof = errors.New("invalid range proof")
+
+// ProveRange constructs a proof that the returned leaves are exactly all the
+// leaves whose node keys are inside [startKey, endKey] in path order (the
+// LSB-first bit order used by getPath). The proof contains the nodes on the
+// paths of startKey and endKey, and can be checked by VerifyRangeProof
+func (mt *ZkTrieImpl) ProveRange(startKey, endKey *zkt.Hash) ([]*Node, []*Node, error) {
+	if comparePath(mt.maxLevels, startKey, endKey) > 0 {
+		return nil, nil, ErrInvalidRangeProof
+	}
+
+	var proof []*Node
+	if err := mt.proveMulti([]*zkt.Hash{startKey, endKey}, func(n *Node) error {
+		proof = append(proof, n)
+		return nil
+	}); err != nil {
+		return nil, nil, err
+	}
+
+	var leaves []*Node
+	it := mt.NewLeafIterator(nil)
+	if err := it.Seek(startKey); err != nil {
+		return nil, nil, err
+	}
+	for it.Next() {
+		if comparePath(mt.maxLevels, it.Key(), endKey) > 0 {
+			break
+		}
+		leaves = append(leaves, it.Node())
+	}
+	if err := it.Error(); err != nil {
+		return nil, nil, err
+	}
+	return leaves, proof, nil
+}
+
+// VerifyRangeProof checks that the keys and values are exactly all the leaves
+// whose node keys are inside [first, last] in path order in the trie with
+// rootHash. The keys must be sorted in path order, and the proof is the edge
+// nodes generated by ProveRange
+func VerifyRangeProof(rootHash, first, last *zkt.Hash, keys []*zkt.Hash, values []LeafValue, proof []*Node) error {
+	return VerifyRangeProofWithHasher(zkt.DefaultHasher, rootHash, first, last, keys, values, proof)
+}
+
+// VerifyRangeProofWithHasher is the same as VerifyRangeProof but use the specified hash scheme
+func VerifyRangeProofWithHasher(h zkt.Hasher, rootHash, first, last *zkt.Hash, keys []*zkt.Hash, values []LeafValue, proof []*Node) error {
+	maxLevels := NodeKeyValidBytes * 8
+	if comparePath(maxLevels, first, last) > 0 || len(keys) != len(values) {
+		return ErrInvalidRangeProof
+	}
+	leaves := make([]*Node, len(keys))
+	for i, key := range keys {
+		if !zkt.CheckBigIntInField(key.BigInt()) || checkValuePreimage(values[i].Preimage) != nil {
+			return ErrInvalidRangeProof
+		}
+		leaf := NewLeafNode(key, values[i].Flag, values[i].Preimage)
+		leaves[i] = leaf
+		if comparePath(maxLevels, leaf.NodeKey, first) < 0 || comparePath(maxLevels, leaf.NodeKey, last) > 0 {
+			return ErrInvalidRangeProof
+		}
+		if i > 0 && comparePath(maxLevels, leaves[i-1].NodeKey, leaf.NodeKey) >= 0 {
+			return ErrInvalidRangeProof
+		}
+	}
+
+	v := &rangeVerifier{
+		hasher:    h,
+		maxLevels: maxLevels,
+		first:     first,
+		last:      last,
+		firstPath: getPath(maxLevels, first[:]),
+		lastPath:  getPath(maxLevels, last[:]),
+		proofDb:   make(map[zkt.Hash]*Node, len(proof)),
+	}
+	for _, n := range proof {
+		nodeHash, err := n.NodeHashWithHasher(h)
+		if err != nil {
+			return err
+		}
+		v.proofDb[*nodeHash] = n
+	}
+
+	computed, err := v.verify(rootHash, 0, true, true, leaves)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(computed[:], rootHash[:]) {
+		return ErrInvalidRangeProof
+	}
+	return nil
+}
+
+type rangeVerifier struct {
+	hasher              zkt.Hasher
+	maxLevels           int
+	first, last         *zkt.Hash
+	firstPath, lastPath []bool
+	proofDb             map[zkt.Hash]*Node
+}
+
+// verify calculates the hash of the sub-trie at depth which is expected to
+// have nodeHash, onFirst / onLast indicates the sub-trie is on the path of
+// first / last key. The sub-tries between the edge paths are rebuilt from
+// the leaves only, and the ones outside the range are taken from the proof
+func (v *rangeVerifier) verify(nodeHash *zkt.Hash, depth int, onFirst, onLast bool, leaves []*Node) (*zkt.Hash, error) {
+	if !onFirst && !onLast {
+		return v.build(depth, leaves)
+	}
+	if depth >= v.maxLevels {
+		return nil, ErrReachedMaxLevel
+	}
+	if *nodeHash == zkt.HashZero {
+		if len(leaves) != 0 {
+			return nil, ErrInvalidRangeProof
+		}
+		return &zkt.HashZero, nil
+	}
+	n, ok := v.proofDb[*nodeHash]
+	if !ok {
+		return nil, &MissingNodeError{NodeHash: nodeHash, Path: v.edgePath(depth, onFirst), Err: ErrKeyNotFound}
+	}
+
+	switch n.Type {
+	case NodeTypeLeaf:
+		inRange := comparePath(v.maxLevels, n.NodeKey, v.first) >= 0 && comparePath(v.maxLevels, n.NodeKey, v.last) <= 0
+		if !inRange {
+			if len(leaves) != 0 {
+				return nil, ErrInvalidRangeProof
+			}
+			return n.NodeHashWithHasher(v.hasher)
+		}
+		if len(leaves) != 1 || !bytes.Equal(leaves[0].NodeKey[:], n.NodeKey[:]) {
+			return nil, ErrInvalidRangeProof
+		}
+		return leaves[0].NodeHashWithHasher(v.hasher)
+	case NodeTypeParent:
+		leftLeaves, rightLeaves := splitLeaves(depth, leaves)
+		var children [2]*zkt.Hash
+		for i, right := range []bool{false, true} {
+			childHash, sub := n.ChildL, leftLeaves
+			if right {
+				childHash, sub = n.ChildR, rightLeaves
+			}
+			// sub-trie on the left of first key or the right of last key
+			if (onFirst && !right && v.firstPath[depth]) || (onLast && right && !v.lastPath[depth]) {
+				if len(sub) != 0 {
+					return nil, ErrInvalidRangeProof
+				}
+				children[i] = childHash
+				continue
+			}
+			childOnFirst := onFirst && v.firstPath[depth] == right
+			childOnLast := onLast && v.lastPath[depth] == right
+			computed, err := v.verify(childHash, depth+1, childOnFirst, childOnLast, sub)
+			if err != nil {
+				return nil, err
+			}
+			children[i] = computed
+		}
+		return NewParentNode(children[0], children[1]).NodeHashWithHasher(v.hasher)
+	default:
+		return nil, ErrInvalidNodeFound
+	}
+}
+
+// build calculates the hash of a sub-trie at depth which contains only the leaves
+func (v *rangeVerifier) build(depth int, leaves []*Node) (*zkt.Hash, error) {
+	switch len(leaves) {
+	case 0:
+		return &zkt.HashZero, nil
+	case 1:
+		return leaves[0].NodeHashWithHasher(v.hasher)
+	}
+	if depth >= v.maxLevels {
+		return nil, ErrReachedMaxLevel
+	}
+	leftLeaves, rightLeaves := splitLeaves(depth, leaves)
+	left, err := v.build(depth+1, leftLeaves)
+	if err != nil {
+		return nil, err
+	}
+	right, err := v.build(depth+1, rightLeaves)
+	if err != nil {
+		return nil, err
+	}
+	return NewParentNode(left, right).NodeHashWithHasher(v.hasher)
+}
+
+func (v *rangeVerifier) edgePath(depth int, onFirst bool) []bool {
+	if onFirst {
+		return v.firstPath[:depth]
+	}
+	return v.lastPath[:depth]
+}
+
+// splitLeaves splits the leaves sorted in path order by the bit at depth
+func splitLeaves(depth int, leaves []*Node) ([]*Node, []*Node) {
+	for i, leaf := range leaves {
+		if zkt.TestBit(leaf.NodeKey[:], uint(depth)) {
+			return leaves[:i], leaves[i:]
+		}
+	}
+	return leaves, nil
+}
@@ -0,0 +1,96 @@
+package trie
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	zkt "github.com/scroll-tech/zktrie/types"
+)
+
+// verifyRangeLeaves verifies the leaves returned by ProveRange
+func verifyRangeLeaves(rootHash, first, last *zkt.Hash, leaves []*Node, proof []*Node) error {
+	keys := make([]*zkt.Hash, len(leaves))
+	values := make([]LeafValue, len(leaves))
+	for i, leaf := range leaves {
+		keys[i] = leaf.NodeKey
+		values[i] = LeafValue{Flag: leaf.CompressedFlags, Preimage: leaf.ValuePreimage}
+	}
+	return VerifyRangeProof(rootHash, first, last, keys, values, proof)
+}
+
+func TestRangeProof(t *testing.T) {
+	mt, keys := newIteratorTestingTrie(t, 30)
+	root := mt.Root()
+
+	t.Run("Ranges", func(t *testing.T) {
+		for _, r := range [][2]*zkt.Hash{
+			{keys[0], keys[len(keys)-1]},
+			{keys[3], keys[17]},
+			{keys[5], keys[5]},
+			{zkt.NewHashFromBytes([]byte{2}), zkt.NewHashFromBytes([]byte{250})},
+			{zkt.NewHashFromBytes([]byte{0}), zkt.NewHashFromBytes([]byte{255})},
+			{zkt.NewHashFromBytes([]byte{4}), zkt.NewHashFromBytes([]byte{4})},
+		} {
+			if comparePath(mt.maxLevels, r[0], r[1]) > 0 {
+				r[0], r[1] = r[1], r[0]
+			}
+			leaves, proof, err := mt.ProveRange(r[0], r[1])
+			assert.NoError(t, err)
+			for _, leaf := range leaves {
+				assert.True(t, comparePath(mt.maxLevels, leaf.NodeKey, r[0]) >= 0)
+				assert.True(t, comparePath(mt.maxLevels, leaf.NodeKey, r[1]) <= 0)
+			}
+			assert.NoError(t, verifyRangeLeaves(root, r[0], r[1], leaves, proof))
+		}
+	})
+
+	t.Run("Incomplete or forged leaves", func(t *testing.T) {
+		leaves, proof, err := mt.ProveRange(keys[3], keys[17])
+		assert.NoError(t, err)
+		assert.Equal(t, 15, len(leaves))
+
+		// drop a leaf in the middle
+		dropped := append(append([]*Node{}, leaves[:7]...), leaves[8:]...)
+		assert.Error(t, verifyRangeLeaves(root, keys[3], keys[17], dropped, proof))
+
+		// drop the edge leaf
+		assert.Error(t, verifyRangeLeaves(root, keys[3], keys[17], leaves[1:], proof))
+		assert.Error(t, verifyRangeLeaves(root, keys[3], keys[17], leaves[:len(leaves)-1], proof))
+
+		// modify a value
+		modified := append([]*Node{}, leaves...)
+		modified[7] = NewLeafNode(leaves[7].NodeKey, 1, []zkt.Byte32{{0xff}})
+		assert.Error(t, verifyRangeLeaves(root, keys[3], keys[17], modified, proof))
+
+		// extra leaf
+		extra := append([]*Node{}, leaves...)
+		extra = append(extra, NewLeafNode(keys[18], 1, []zkt.Byte32{{0xff}}))
+		assert.Error(t, verifyRangeLeaves(root, keys[3], keys[18], extra, proof))
+
+		// unsorted leaves
+		unsorted := append([]*Node{}, leaves...)
+		unsorted[1], unsorted[2] = unsorted[2], unsorted[1]
+		assert.Equal(t, ErrInvalidRangeProof, verifyRangeLeaves(root, keys[3], keys[17], unsorted, proof))
+
+		// wrong root
+		assert.Error(t, verifyRangeLeaves(zkt.NewHashFromBytes([]byte{1}), keys[3], keys[17], leaves, proof))
+
+		// missing edge proof
+		assert.Error(t, verifyRangeLeaves(root, keys[3], keys[17], leaves, proof[1:]))
+
+		// keys and values of different lengths
+		assert.Equal(t, ErrInvalidRangeProof, VerifyRangeProof(root, keys[3], keys[17], []*zkt.Hash{keys[3]}, nil, proof))
+	})
+
+	t.Run("Empty trie", func(t *testing.T) {
+		emptyMT := newTestingMerkle(t, 10)
+		leaves, proof, err := emptyMT.ProveRange(keys[0], keys[1])
+		assert.NoError(t, err)
+		assert.Empty(t, leaves)
+		assert.NoError(t, verifyRangeLeaves(emptyMT.Root(), keys[0], keys[1], leaves, proof))
+	})
+
+	_, _, err := mt.ProveRange(keys[1], keys[0])
+	assert.Equal(t, ErrInvalidRangeProof, err)
+}
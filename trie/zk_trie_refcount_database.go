@@ -0,0 +1,219 @@
+package trie
+
+import (
+	"encoding/binary"
+	"errors"
+	"math/big"
+	"sync"
+
+	zkt "github.com/scroll-tech/zktrie/types"
+)
+
+// refCountPrefix is the key prefix of the reference counters in the db
+var refCountPrefix = []byte("zktrie-refcount-")
+
+// ErrReferenceUnderflow is returned when dereferencing a node which is not referenced
+var ErrReferenceUnderflow = errors.New("dereference a node with zero reference count")
+
+// BatchDatabase is a ZktrieDatabase which supports batch writes
+type BatchDatabase interface {
+	ZktrieDatabase
+	Batcher
+}
+
+// RefCountDatabase is a ZktrieDatabase which tracks how many references each
+// node has and physically deletes the nodes no longer being referenced. A node
+// is referenced by each live root pointing to it (see Reference) and by each
+// referenced parent node. The counters are persisted in the underlying db along
+// with the nodes, so they survive restarts.
+//
+// Nodes written by a trie are not referenced until their root is passed to
+// Reference, the caller should Reference the root after a trie is committed
+// and Dereference it when the root is no longer needed. Notice the new root
+// must be referenced before dereferencing the old one, or the nodes shared by
+// them would be deleted
+type RefCountDatabase struct {
+	db   BatchDatabase
+	lock sync.Mutex
+}
+
+// NewRefCountDatabase creates a reference-counting layer over db
+func NewRefCountDatabase(db BatchDatabase) *RefCountDatabase {
+	return &RefCountDatabase{db: db}
+}
+
+func (db *RefCountDatabase) UpdatePreimage(preimage []byte, hashField *big.Int) {
+	db.db.UpdatePreimage(preimage, hashField)
+}
+
+func (db *RefCountDatabase) Preimage(hashField *big.Int) ([]byte, bool) {
+	return db.db.Preimage(hashField)
+}
+
+func (db *RefCountDatabase) Put(k, v []byte) error {
+	return db.db.Put(k, v)
+}
+
+func (db *RefCountDatabase) Get(key []byte) ([]byte, error) {
+	return db.db.Get(key)
+}
+
+func (db *RefCountDatabase) NewBatch() Batch {
+	return db.db.NewBatch()
+}
+
+// RefCount returns the reference count of the node
+func (db *RefCountDatabase) RefCount(nodeHash *zkt.Hash) (uint64, error) {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	return (&refCountUpdate{db: db}).count(nodeHash)
+}
+
+// Reference adds a reference to the trie with root, if the root is referenced
+// for the first time, all of its descendants are referenced too
+func (db *RefCountDatabase) Reference(root *zkt.Hash) error {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	u := db.newUpdate()
+	if err := u.reference(root); err != nil {
+		return err
+	}
+	return u.write()
+}
+
+// Dereference removes a reference to the trie with root, the nodes whose
+// reference count drops to zero are deleted from the db
+func (db *RefCountDatabase) Dereference(root *zkt.Hash) error {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	u := db.newUpdate()
+	if err := u.dereference(root); err != nil {
+		return err
+	}
+	return u.write()
+}
+
+func (db *RefCountDatabase) newUpdate() *refCountUpdate {
+	return &refCountUpdate{
+		db:      db,
+		batch:   db.db.NewBatch(),
+		pending: make(map[zkt.Hash]uint64),
+	}
+}
+
+// refCountUpdate collects the changes of one Reference / Dereference call
+// so they are written to the db in one batch
+type refCountUpdate struct {
+	db      *RefCountDatabase
+	batch   Batch
+	pending map[zkt.Hash]uint64
+}
+
+func refCountKey(nodeHash *zkt.Hash) []byte {
+	return append(append([]byte{}, refCountPrefix...), nodeHash[:]...)
+}
+
+func (u *refCountUpdate) count(nodeHash *zkt.Hash) (uint64, error) {
+	if n, ok := u.pending[*nodeHash]; ok {
+		return n, nil
+	}
+	v, err := u.db.db.Get(refCountKey(nodeHash))
+	if err == ErrKeyNotFound {
+		return 0, nil
+	} else if err != nil {
+		return 0, err
+	}
+	if len(v) != 8 {
+		return 0, ErrNodeBytesBadSize
+	}
+	return binary.BigEndian.Uint64(v), nil
+}
+
+func (u *refCountUpdate) children(nodeHash *zkt.Hash) ([]*zkt.Hash, error) {
+	nBytes, err := u.db.db.Get(nodeHash[:])
+	if err != nil {
+		return nil, err
+	}
+	n, err := NewNodeFromBytes(nBytes)
+	if err != nil {
+		return nil, err
+	}
+	if n.Type != NodeTypeParent {
+		return nil, nil
+	}
+	return []*zkt.Hash{n.ChildL, n.ChildR}, nil
+}
+
+func (u *refCountUpdate) reference(nodeHash *zkt.Hash) error {
+	if *nodeHash == zkt.HashZero {
+		return nil
+	}
+	n, err := u.count(nodeHash)
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		// the node becomes live, so do its children
+		children, err := u.children(nodeHash)
+		if err != nil {
+			return err
+		}
+		for _, child := range children {
+			if err := u.reference(child); err != nil {
+				return err
+			}
+		}
+	}
+	u.pending[*nodeHash] = n + 1
+	return nil
+}
+
+func (u *refCountUpdate) dereference(nodeHash *zkt.Hash) error {
+	if *nodeHash == zkt.HashZero {
+		return nil
+	}
+	n, err := u.count(nodeHash)
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrReferenceUnderflow
+	}
+	u.pending[*nodeHash] = n - 1
+	if n > 1 {
+		return nil
+	}
+
+	children, err := u.children(nodeHash)
+	if err != nil {
+		return err
+	}
+	for _, child := range children {
+		if err := u.dereference(child); err != nil {
+			return err
+		}
+	}
+	return u.batch.Delete(nodeHash[:])
+}
+
+func (u *refCountUpdate) write() error {
+	for nodeHash, n := range u.pending {
+		nodeHash := nodeHash
+		key := refCountKey(&nodeHash)
+		if n == 0 {
+			if err := u.batch.Delete(key); err != nil {
+				return err
+			}
+			continue
+		}
+		var v [8]byte
+		binary.BigEndian.PutUint64(v[:], n)
+		if err := u.batch.Put(key, v[:]); err != nil {
+			return err
+		}
+	}
+	return u.batch.Write()
+}
@@ -0,0 +1,85 @@
+package trie
+
+import (
+	"testing"
+
+	zkt "github.com/scroll-tech/zktrie/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRefCountDatabase(t *testing.T) {
+	memDb := NewZkTrieMemoryDb()
+	db := NewRefCountDatabase(memDb)
+
+	countNodes := func(root *zkt.Hash) int {
+		mt, err := newZkTrieImplWithRoot(db, root, 10)
+		assert.NoError(t, err)
+		num := 0
+		assert.NoError(t, mt.Walk(root, func(n *Node) {
+			if n.Type != NodeTypeEmpty {
+				num++
+			}
+		}))
+		return num
+	}
+
+	mt, err := newZkTrieImpl(db, 10)
+	assert.NoError(t, err)
+	for i := 0; i < 16; i++ {
+		err := mt.UpdateWord(zkt.NewByte32FromBytes([]byte{byte(i)}), zkt.NewByte32FromBytes([]byte{byte(i)}))
+		assert.NoError(t, err)
+	}
+	root1, _, err := mt.Commit()
+	assert.NoError(t, err)
+	assert.NoError(t, db.Reference(root1))
+
+	for i := 0; i < 4; i++ {
+		err := mt.UpdateWord(zkt.NewByte32FromBytes([]byte{byte(i)}), zkt.NewByte32FromBytes([]byte{byte(i + 100)}))
+		assert.NoError(t, err)
+	}
+	root2, _, err := mt.Commit()
+	assert.NoError(t, err)
+	assert.NoError(t, db.Reference(root2))
+	num2 := countNodes(root2)
+
+	n, err := db.RefCount(root1)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(1), n)
+
+	// referencing a root again only increases the counter of root
+	assert.NoError(t, db.Reference(root2))
+	n, err = db.RefCount(root2)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(2), n)
+	assert.NoError(t, db.Dereference(root2))
+
+	// nodes and counters of both roots, plus the current root entry
+	assert.Less(t, 2*num2+1, len(memDb.db))
+
+	assert.NoError(t, db.Dereference(root1))
+	_, err = db.Get(root1[:])
+	assert.Equal(t, ErrKeyNotFound, err)
+	// only the nodes and counters of root2 are left
+	assert.Equal(t, 2*num2+1, len(memDb.db))
+	assert.Equal(t, num2, countNodes(root2))
+
+	// read the trie at root2
+	mt2, err := newZkTrieImplWithRoot(db, root2, 10)
+	assert.NoError(t, err)
+	for i := 0; i < 16; i++ {
+		node, err := mt2.GetLeafNodeByWord(zkt.NewByte32FromBytes([]byte{byte(i)}))
+		assert.NoError(t, err)
+		expected := byte(i)
+		if i < 4 {
+			expected += 100
+		}
+		assert.Equal(t, zkt.NewByte32FromBytes([]byte{expected})[:], node.ValuePreimage[0][:])
+	}
+
+	assert.NoError(t, db.Dereference(root2))
+	assert.Equal(t, 1, len(memDb.db))
+	assert.Equal(t, ErrReferenceUnderflow, db.Dereference(root2))
+
+	// referencing a root not in db
+	assert.Equal(t, ErrKeyNotFound, db.Reference(root2))
+}
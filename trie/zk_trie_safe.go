@@ -0,0 +1,121 @@
+package trie
+
+import (
+	"sync"
+
+	zkt "github.com/scroll-tech/zktrie/types"
+)
+
+// SafeZkTrie is a ZkTrie which is safe for concurrent use. The reads and
+// writes on the latest (possibly uncommitted) state are serialized by a
+// read-write lock, so there can be many concurrent readers or a single writer.
+// Snapshot provides a handle pinned on the latest committed root, which is
+// read without any locking and never sees the later writes.
+type SafeZkTrie struct {
+	trie      *ZkTrie
+	committed *ZkTrie // read-only view of the latest committed state
+	lock      sync.RWMutex
+}
+
+// NewSafeZkTrie creates a concurrency-safe trie with the committed root
+func NewSafeZkTrie(root zkt.Byte32, db ZktrieDatabase) (*SafeZkTrie, error) {
+	return NewSafeZkTrieWithHasher(root, db, zkt.DefaultHasher)
+}
+
+// NewSafeZkTrieWithHasher is the same as NewSafeZkTrie but use the specified hash scheme
+func NewSafeZkTrieWithHasher(root zkt.Byte32, db ZktrieDatabase, hasher zkt.Hasher) (*SafeZkTrie, error) {
+	t, err := NewZkTrieWithHasher(root, db, hasher)
+	if err != nil {
+		return nil, err
+	}
+	return &SafeZkTrie{trie: t, committed: t.AsReadOnly()}, nil
+}
+
+// TryGet returns the value for key in the latest state
+func (t *SafeZkTrie) TryGet(key []byte) ([]byte, error) {
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+
+	return t.trie.TryGet(key)
+}
+
+// TryGetNode returns the node by binary path in the latest state, see ZkTrie.TryGetNode
+func (t *SafeZkTrie) TryGetNode(path []byte) ([]byte, int, error) {
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+
+	return t.trie.TryGetNode(path)
+}
+
+// TryUpdate associates key with value in the trie, see ZkTrie.TryUpdate
+func (t *SafeZkTrie) TryUpdate(key []byte, vFlag uint32, vPreimage []zkt.Byte32) error {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	return t.trie.TryUpdate(key, vFlag, vPreimage)
+}
+
+// TryDelete removes any existing value for key from the trie
+func (t *SafeZkTrie) TryDelete(key []byte) error {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	return t.trie.TryDelete(key)
+}
+
+// Hash returns the root hash of the latest state
+func (t *SafeZkTrie) Hash() []byte {
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+
+	return t.trie.Hash()
+}
+
+// Commit writes all the uncommitted nodes into the database, the snapshots
+// taken after it are pinned on the new root
+func (t *SafeZkTrie) Commit() (*zkt.Hash, *NodeSet, error) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	root, set, err := t.trie.Commit()
+	if err != nil {
+		return nil, nil, err
+	}
+	t.committed = t.trie.AsReadOnly()
+	return root, set, nil
+}
+
+// Prove constructs a merkle proof for key in the latest state, see ZkTrie.Prove
+func (t *SafeZkTrie) Prove(key []byte, fromLevel uint, writeNode func(*Node) error) error {
+	return t.ProveWithDeletion(key, fromLevel, writeNode, nil)
+}
+
+// ProveWithDeletion constructs a merkle proof for key in the latest state,
+// see ZkTrie.ProveWithDeletion
+func (t *SafeZkTrie) ProveWithDeletion(key []byte, fromLevel uint, writeNode func(*Node) error, onHit func(*Node, *Node)) error {
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+
+	return t.trie.ProveWithDeletion(key, fromLevel, writeNode, onHit)
+}
+
+// ProveMulti constructs a merkle proof for multiple keys in the latest state,
+// see ZkTrie.ProveMulti
+func (t *SafeZkTrie) ProveMulti(keys [][]byte, writeNode func(*Node) error) error {
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+
+	return t.trie.ProveMulti(keys, writeNode)
+}
+
+// Snapshot returns a read-only trie pinned on the latest committed root, the
+// uncommitted and later writes are not visible to it. The snapshot can be
+// read concurrently without locking, and any attempt to modify it returns
+// ErrNotWritable. Notice the snapshot relies on the nodes of its root being
+// kept in the database, i.e. they must not be pruned while it is in use
+func (t *SafeZkTrie) Snapshot() *ZkTrie {
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+
+	return t.committed.AsReadOnly()
+}
@@ -0,0 +1,79 @@
+package trie
+
+import (
+	"sync"
+	"testing"
+
+	zkt "github.com/scroll-tech/zktrie/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSafeZkTrie_Snapshot(t *testing.T) {
+	safe, err := NewSafeZkTrie(zkt.Byte32{}, NewZkTrieMemoryDb())
+	assert.NoError(t, err)
+
+	key := func(i int) []byte {
+		k := make([]byte, 32)
+		k[31] = byte(i + 1)
+		return k
+	}
+
+	for i := 0; i < 8; i++ {
+		assert.NoError(t, safe.TryUpdate(key(i), 1, []zkt.Byte32{{0}}))
+	}
+	// uncommitted writes are not visible to the snapshot
+	empty := safe.Snapshot()
+	assert.Equal(t, zkt.HashZero.Bytes(), empty.Hash())
+
+	root, _, err := safe.Commit()
+	assert.NoError(t, err)
+	snap := safe.Snapshot()
+	assert.Equal(t, root.Bytes(), snap.Hash())
+	assert.Equal(t, ErrNotWritable, snap.TryUpdate(key(0), 1, []zkt.Byte32{{1}}))
+	_, _, err = snap.Commit()
+	assert.Equal(t, ErrNotWritable, err)
+
+	var wg sync.WaitGroup
+	// the writer keeps updating and committing
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for round := 1; round <= 20; round++ {
+			for i := 0; i < 8; i++ {
+				assert.NoError(t, safe.TryUpdate(key(i), 1, []zkt.Byte32{{byte(round)}}))
+			}
+			_, _, err := safe.Commit()
+			assert.NoError(t, err)
+		}
+	}()
+	// readers on the pinned snapshot and the latest state
+	for w := 0; w < 4; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for round := 0; round < 20; round++ {
+				for i := 0; i < 8; i++ {
+					value, err := snap.TryGet(key(i))
+					assert.NoError(t, err)
+					assert.Equal(t, (&zkt.Byte32{0}).Bytes(), value)
+
+					value, err = safe.TryGet(key(i))
+					assert.NoError(t, err)
+					assert.NotNil(t, value)
+
+					err = snap.Prove(key(i), 0, func(*Node) error { return nil })
+					assert.NoError(t, err)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(t, root.Bytes(), snap.Hash())
+	latest := safe.Snapshot()
+	for i := 0; i < 8; i++ {
+		value, err := latest.TryGet(key(i))
+		assert.NoError(t, err)
+		assert.Equal(t, (&zkt.Byte32{20}).Bytes(), value)
+	}
+}
@@ -0,0 +1,207 @@
+package trie
+
+import (
+	"errors"
+
+	zkt "github.com/scroll-tech/zktrie/types"
+)
+
+// ErrUnsortedLeaves is returned when the leaves added to StackTrieBuilder are
+// not strictly increasing in path order
+var ErrUnsortedLeaves = errors.New("leaves are not sorted in path order")
+
+// stackTrieItem is a finished sub-trie waiting for its sibling
+type stackTrieItem struct {
+	hash    *zkt.Hash
+	depth   int
+	nodeKey *zkt.Hash // node key of any leaf inside, used to locate the sub-trie
+}
+
+// StackTrieBuilder constructs a trie bottom-up from leaves sorted in path
+// order (the LSB-first bit order used by getPath) in a single pass. The depth
+// of a leaf is determined once the next leaf is known, then the finished
+// sub-tries on the left are folded into their parents, so each node is hashed
+// and written into the db exactly once. The resulted root is the same as
+// inserting the leaves into an empty ZkTrieImpl one by one.
+//
+// Only the sub-tries on the path of the latest leaf are kept in memory, the
+// nodes are written through a batch if the db implements Batcher
+type StackTrieBuilder struct {
+	db        ZktrieDatabase
+	batch     Batch
+	hasher    zkt.Hasher
+	maxLevels int
+
+	pending    *Node // the latest leaf whose depth is not determined yet
+	pendingLcp int   // common prefix length of pending leaf and its predecessor
+	stack      []*stackTrieItem
+	committed  bool
+}
+
+// NewStackTrieBuilder creates a builder which writes the nodes into db
+func NewStackTrieBuilder(db ZktrieDatabase, maxLevels int) *StackTrieBuilder {
+	return NewStackTrieBuilderWithHasher(db, maxLevels, zkt.DefaultHasher)
+}
+
+// NewStackTrieBuilderWithHasher is the same as NewStackTrieBuilder but use the specified hash scheme
+func NewStackTrieBuilderWithHasher(db ZktrieDatabase, maxLevels int, hasher zkt.Hasher) *StackTrieBuilder {
+	b := &StackTrieBuilder{db: db, hasher: hasher, maxLevels: maxLevels}
+	if batcher, ok := db.(Batcher); ok {
+		b.batch = batcher.NewBatch()
+	}
+	return b
+}
+
+// commonPrefixLen returns the number of leading path bits shared by a and b
+func commonPrefixLen(numLevels int, a, b *zkt.Hash) int {
+	for i := 0; i < numLevels; i++ {
+		if zkt.TestBit(a[:], uint(i)) != zkt.TestBit(b[:], uint(i)) {
+			return i
+		}
+	}
+	return numLevels
+}
+
+// Add appends a leaf to the trie, its node key must be greater than the ones
+// of all the added leaves in path order
+func (b *StackTrieBuilder) Add(nodeKey *zkt.Hash, vFlag uint32, vPreimage []zkt.Byte32) error {
+	if b.committed {
+		return ErrNotWritable
+	}
+	// verify that k are valid and fit inside the Finite Field.
+	if !zkt.CheckBigIntInField(nodeKey.BigInt()) {
+		return ErrInvalidField
+	}
+	if err := checkValuePreimage(vPreimage); err != nil {
+		return err
+	}
+
+	leaf := NewLeafNode(nodeKey, vFlag, vPreimage)
+	if b.pending == nil {
+		b.pending = leaf
+		return nil
+	}
+
+	if comparePath(b.maxLevels, b.pending.NodeKey, nodeKey) >= 0 {
+		return ErrUnsortedLeaves
+	}
+	lcp := commonPrefixLen(b.maxLevels, b.pending.NodeKey, nodeKey)
+	if lcp > b.maxLevels-2 {
+		return ErrReachedMaxLevel
+	}
+
+	// the pending leaf sits right below the deeper divergence with its neighbours
+	depth := b.pendingLcp
+	if lcp > depth {
+		depth = lcp
+	}
+	if err := b.push(b.pending, depth+1); err != nil {
+		return err
+	}
+	// the sub-trie at lcp+1 containing the pending leaf is finished
+	if err := b.fold(lcp + 1); err != nil {
+		return err
+	}
+	b.pending, b.pendingLcp = leaf, lcp
+	return nil
+}
+
+// push writes the leaf and pushes it onto the stack
+func (b *StackTrieBuilder) push(leaf *Node, depth int) error {
+	leafHash, err := b.writeNode(leaf)
+	if err != nil {
+		return err
+	}
+	b.stack = append(b.stack, &stackTrieItem{hash: leafHash, depth: depth, nodeKey: leaf.NodeKey})
+	return nil
+}
+
+// fold merges the finished sub-tries on the stack until the top one is not
+// deeper than depth
+func (b *StackTrieBuilder) fold(depth int) error {
+	for len(b.stack) > 0 {
+		top := b.stack[len(b.stack)-1]
+		if top.depth <= depth {
+			return nil
+		}
+		b.stack = b.stack[:len(b.stack)-1]
+
+		var parent *Node
+		if zkt.TestBit(top.nodeKey[:], uint(top.depth-1)) {
+			left := &zkt.HashZero
+			if len(b.stack) > 0 && b.stack[len(b.stack)-1].depth == top.depth {
+				left = b.stack[len(b.stack)-1].hash
+				b.stack = b.stack[:len(b.stack)-1]
+			}
+			parent = NewParentNode(left, top.hash)
+		} else {
+			parent = NewParentNode(top.hash, &zkt.HashZero)
+		}
+		parentHash, err := b.writeNode(parent)
+		if err != nil {
+			return err
+		}
+		b.stack = append(b.stack, &stackTrieItem{hash: parentHash, depth: top.depth - 1, nodeKey: top.nodeKey})
+	}
+	return nil
+}
+
+func (b *StackTrieBuilder) writeNode(n *Node) (*zkt.Hash, error) {
+	nodeHash, err := n.NodeHashWithHasher(b.hasher)
+	if err != nil {
+		return nil, err
+	}
+	if b.batch == nil {
+		return nodeHash, b.db.Put(nodeHash[:], n.CanonicalValue())
+	}
+	if err := b.batch.Put(nodeHash[:], n.CanonicalValue()); err != nil {
+		return nil, err
+	}
+	if b.batch.ValueSize() >= idealBatchSize {
+		if err := b.batch.Write(); err != nil {
+			return nil, err
+		}
+		b.batch.Reset()
+	}
+	return nodeHash, nil
+}
+
+// Commit finishes the trie and writes the root entry into db, it returns the
+// root hash. No leaf can be added after Commit
+func (b *StackTrieBuilder) Commit() (*zkt.Hash, error) {
+	if b.committed {
+		return nil, ErrNotWritable
+	}
+	b.committed = true
+
+	root := &zkt.HashZero
+	if b.pending != nil {
+		depth := b.pendingLcp + 1
+		if len(b.stack) == 0 {
+			// the sole leaf is the root
+			depth = 0
+		}
+		if err := b.push(b.pending, depth); err != nil {
+			return nil, err
+		}
+		if err := b.fold(0); err != nil {
+			return nil, err
+		}
+		root = b.stack[0].hash
+		b.pending, b.stack = nil, nil
+	}
+
+	var w kvWriter = b.db
+	if b.batch != nil {
+		w = b.batch
+	}
+	if err := w.Put(dbKeyRootNode, append([]byte{byte(DBEntryTypeRoot)}, root[:]...)); err != nil {
+		return nil, err
+	}
+	if b.batch != nil {
+		if err := b.batch.Write(); err != nil {
+			return nil, err
+		}
+	}
+	return root, nil
+}
@@ -0,0 +1,66 @@
+package trie
+
+import (
+	"math/rand"
+	"sort"
+	"testing"
+
+	zkt "github.com/scroll-tech/zktrie/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStackTrieBuilder(t *testing.T) {
+	for _, num := range []int{0, 1, 2, 3, 17, 300} {
+		r := rand.New(rand.NewSource(int64(num)))
+		keys := make([]*zkt.Hash, num)
+		for i := range keys {
+			var k zkt.Byte32
+			r.Read(k[1:])
+			keys[i] = zkt.NewHashFromBytes(k[:])
+		}
+		sort.Slice(keys, func(i, j int) bool {
+			return comparePath(NodeKeyValidBytes*8, keys[i], keys[j]) < 0
+		})
+
+		mt, err := NewZkTrieImpl(NewZkTrieMemoryDb(), NodeKeyValidBytes*8)
+		assert.NoError(t, err)
+		db := NewZkTrieMemoryDb()
+		builder := NewStackTrieBuilder(db, NodeKeyValidBytes*8)
+		for i, k := range keys {
+			assert.NoError(t, mt.TryUpdate(k, 1, []zkt.Byte32{{byte(i)}}))
+			assert.NoError(t, builder.Add(k, 1, []zkt.Byte32{{byte(i)}}))
+		}
+		root, set, err := mt.Commit()
+		assert.NoError(t, err)
+		built, err := builder.Commit()
+		assert.NoError(t, err)
+		assert.Equal(t, root, built, "leaves %d", num)
+
+		// exactly the nodes of the trie are written, plus the root entry
+		assert.Equal(t, set.Len()+1, len(db.db))
+		loaded, err := NewZkTrieImplWithRoot(db, built, NodeKeyValidBytes*8)
+		assert.NoError(t, err)
+		for i, k := range keys {
+			node, err := loaded.GetLeafNode(k)
+			assert.NoError(t, err)
+			assert.Equal(t, zkt.Byte32{byte(i)}, node.ValuePreimage[0])
+		}
+	}
+}
+
+func TestStackTrieBuilder_Invalid(t *testing.T) {
+	builder := NewStackTrieBuilder(NewZkTrieMemoryDb(), 10)
+	// the path of 0b01 is 1, 0, ... and the path of 0b10 is 0, 1, ...
+	assert.NoError(t, builder.Add(zkt.NewHashFromBytes([]byte{0b01}), 1, []zkt.Byte32{{1}}))
+	assert.Equal(t, ErrUnsortedLeaves, builder.Add(zkt.NewHashFromBytes([]byte{0b01}), 1, []zkt.Byte32{{1}}))
+	assert.Equal(t, ErrUnsortedLeaves, builder.Add(zkt.NewHashFromBytes([]byte{0b10}), 1, []zkt.Byte32{{1}}))
+	// the paths diverge beyond the max levels
+	assert.Equal(t, ErrReachedMaxLevel, builder.Add(zkt.NewHashFromBytes([]byte{0b10, 0b01}), 1, []zkt.Byte32{{1}}))
+	assert.NoError(t, builder.Add(zkt.NewHashFromBytes([]byte{0b11}), 1, []zkt.Byte32{{1}}))
+
+	_, err := builder.Commit()
+	assert.NoError(t, err)
+	assert.Equal(t, ErrNotWritable, builder.Add(zkt.NewHashFromBytes([]byte{0b111}), 1, []zkt.Byte32{{1}}))
+	_, err = builder.Commit()
+	assert.Equal(t, ErrNotWritable, err)
+}
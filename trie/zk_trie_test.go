@@ -1,6 +1,7 @@
 package trie
 
 import (
+	"bytes"
 	"fmt"
 	"math/big"
 	"os"
@@ -123,3 +124,345 @@ func TestZkTrie_ProveAndProveWithDeletion(t *testing.T) {
 		}
 	}
 }
+
+func TestZkTrie_WithHasher(t *testing.T) {
+	mockTrie, err := NewZkTrie(zkt.Byte32{}, NewZkTrieMemoryDb())
+	assert.NoError(t, err)
+	poseidonTrie, err := NewZkTrieWithHasher(zkt.Byte32{}, NewZkTrieMemoryDb(), zkt.PoseidonHasher)
+	assert.NoError(t, err)
+
+	for i := 0; i < 5; i++ {
+		key := []byte{byte(i + 1)}
+		value := []zkt.Byte32{{byte(i + 1)}}
+		assert.NoError(t, mockTrie.TryUpdate(key, 1, value))
+		assert.NoError(t, poseidonTrie.TryUpdate(key, 1, value))
+	}
+	assert.NotEqual(t, mockTrie.Hash(), poseidonTrie.Hash())
+
+	for i := 0; i < 5; i++ {
+		key := []byte{byte(i + 1)}
+		for _, tr := range []*ZkTrie{mockTrie, poseidonTrie} {
+			val, err := tr.TryGet(key)
+			assert.NoError(t, err)
+			assert.Equal(t, (&zkt.Byte32{byte(i + 1)}).Bytes(), val)
+
+			k, err := zkt.ToSecureKeyWithHasher(tr.Tree().Hasher(), key)
+			assert.NoError(t, err)
+			proof, node, err := BuildZkTrieProof(tr.Tree().Root(), k, tr.Tree().MaxLevels(), tr.Tree().GetNode)
+			assert.NoError(t, err)
+			assert.True(t, VerifyProofZkTrieWithHasher(tr.Tree().Hasher(), tr.Tree().Root(), proof, node))
+		}
+	}
+
+	cpy := poseidonTrie.Copy()
+	assert.NoError(t, cpy.TryDelete([]byte{1}))
+	assert.NoError(t, poseidonTrie.TryDelete([]byte{1}))
+	assert.Equal(t, poseidonTrie.Hash(), cpy.Hash())
+}
+
+func encodePath(t *testing.T, path []bool) []byte {
+	b, err := EncodeBinaryPath(path)
+	assert.NoError(t, err)
+	return b
+}
+
+func TestZkTrie_TryGetNode(t *testing.T) {
+	zkTrie, err := NewZkTrie(zkt.Byte32{}, NewZkTrieMemoryDb())
+	assert.NoError(t, err)
+
+	node, resolved, err := zkTrie.TryGetNode(encodePath(t, nil))
+	assert.NoError(t, err)
+	assert.Nil(t, node)
+	assert.Equal(t, 0, resolved)
+
+	for i := 0; i < 10; i++ {
+		err := zkTrie.TryUpdate([]byte{byte(i)}, 1, []zkt.Byte32{{byte(i)}})
+		assert.NoError(t, err)
+	}
+
+	cnt := 0
+	it := zkTrie.Tree().NewNodeIterator(nil)
+	for it.Next() {
+		node, resolved, err := zkTrie.TryGetNode(encodePath(t, it.Path()))
+		assert.NoError(t, err)
+		assert.Equal(t, it.Node().CanonicalValue(), node)
+		assert.Equal(t, len(it.Path()), resolved)
+
+		if it.Leaf() {
+			// path going through a leaf
+			node, resolved, err = zkTrie.TryGetNode(encodePath(t, append(it.Path(), false)))
+			assert.NoError(t, err)
+			assert.Nil(t, node)
+			assert.Equal(t, len(it.Path()), resolved)
+		}
+		cnt++
+	}
+	assert.NoError(t, it.Error())
+	assert.Less(t, 10, cnt)
+
+	_, _, err = zkTrie.TryGetNode([]byte{})
+	assert.Equal(t, ErrInvalidPath, err)
+	_, _, err = zkTrie.TryGetNode([]byte{3, 0, 0})
+	assert.Equal(t, ErrInvalidPath, err)
+	_, _, err = zkTrie.TryGetNode([]byte{3, 8})
+	assert.Equal(t, ErrInvalidPath, err)
+}
+
+func TestZkTrie_ProveMulti(t *testing.T) {
+	zkTrie, err := NewZkTrie(zkt.Byte32{}, NewZkTrieMemoryDb())
+	assert.NoError(t, err)
+
+	var keys [][]byte
+	for i := 0; i < 40; i++ {
+		key := []byte{byte(i)}
+		if i%4 != 0 {
+			err := zkTrie.TryUpdate(key, 1, []zkt.Byte32{{byte(i)}})
+			assert.NoError(t, err)
+		}
+		k, err := zkt.ToSecureKeyBytes(key)
+		assert.NoError(t, err)
+		keys = append(keys, k.Bytes())
+	}
+
+	var proofNodes []*Node
+	err = zkTrie.ProveMulti(keys, func(n *Node) error {
+		// transport the nodes as bytes
+		decoded, err := DecodeSMTProof(n.Value())
+		assert.NoError(t, err)
+		proofNodes = append(proofNodes, decoded)
+		return nil
+	})
+	assert.NoError(t, err)
+
+	singleProofSize := 0
+	for _, key := range keys {
+		err := zkTrie.Prove(key, 0, func(*Node) error {
+			singleProofSize++
+			return nil
+		})
+		assert.NoError(t, err)
+	}
+	assert.Less(t, len(proofNodes), singleProofSize)
+
+	root := zkt.NewHashFromBytes(zkTrie.Hash())
+	leaves, err := VerifyMultiProof(root, keys, proofNodes)
+	assert.NoError(t, err)
+	for i, leaf := range leaves {
+		if i%4 == 0 {
+			assert.Nil(t, leaf)
+		} else {
+			assert.Equal(t, (&zkt.Byte32{byte(i)}).Bytes(), leaf.Data())
+		}
+	}
+
+	// wrong root
+	_, err = VerifyMultiProof(zkt.NewHashFromBytes([]byte{1}), keys, proofNodes)
+	assert.ErrorIs(t, err, ErrKeyNotFound)
+
+	// missing the leaf of the last key
+	var lastLeaf *zkt.Hash
+	for _, n := range proofNodes {
+		if n.Type == NodeTypeLeaf && bytes.Equal(n.NodeKey.Bytes(), keys[len(keys)-1]) {
+			lastLeaf, _ = n.NodeHash()
+		}
+	}
+	var partial []*Node
+	for _, n := range proofNodes {
+		if h, _ := n.NodeHash(); *h != *lastLeaf {
+			partial = append(partial, n)
+		}
+	}
+	_, err = VerifyMultiProof(root, keys, partial)
+	missingErr, ok := err.(*MissingNodeError)
+	assert.True(t, ok)
+	assert.Equal(t, lastLeaf, missingErr.NodeHash)
+
+	// tampered value
+	tampered := make([]*Node, len(proofNodes))
+	for i, n := range proofNodes {
+		tampered[i] = n
+		if n.Type == NodeTypeLeaf {
+			tampered[i] = NewLeafNode(n.NodeKey, n.CompressedFlags, []zkt.Byte32{{0xff}})
+		}
+	}
+	_, err = VerifyMultiProof(root, keys, tampered)
+	assert.Error(t, err)
+}
+
+// writeGuardDb fails the test on any write
+type writeGuardDb struct {
+	t  *testing.T
+	db *Database
+}
+
+func (db writeGuardDb) UpdatePreimage([]byte, *big.Int) {
+	db.t.Error("unexpected preimage write")
+}
+
+func (db writeGuardDb) Preimage(hashField *big.Int) ([]byte, bool) {
+	return db.db.Preimage(hashField)
+}
+
+func (db writeGuardDb) Put([]byte, []byte) error {
+	db.t.Error("unexpected write")
+	return nil
+}
+
+func (db writeGuardDb) Get(key []byte) ([]byte, error) {
+	return db.db.Get(key)
+}
+
+func TestZkTrie_ReadOnly(t *testing.T) {
+	db := NewZkTrieMemoryDb()
+	zkTrie, err := NewZkTrie(zkt.Byte32{}, db)
+	assert.NoError(t, err)
+	assert.NoError(t, zkTrie.TryUpdate([]byte("key"), 1, []zkt.Byte32{{1}}))
+	root, _, err := zkTrie.Commit()
+	assert.NoError(t, err)
+
+	readOnly, err := NewZkTrieReadOnly(*zkt.NewByte32FromBytes(root.Bytes()), writeGuardDb{t, db})
+	assert.NoError(t, err)
+	assert.False(t, readOnly.Tree().IsWritable())
+
+	val, err := readOnly.TryGet([]byte("key"))
+	assert.NoError(t, err)
+	assert.Equal(t, (&zkt.Byte32{1}).Bytes(), val)
+
+	assert.Equal(t, ErrNotWritable, readOnly.TryUpdate([]byte("key"), 1, []zkt.Byte32{{2}}))
+	assert.Equal(t, ErrNotWritable, readOnly.TryUpdate([]byte("key2"), 1, []zkt.Byte32{{2}}))
+	assert.Equal(t, ErrNotWritable, readOnly.TryDelete([]byte("key")))
+	assert.Equal(t, ErrNotWritable, readOnly.TryDelete([]byte("key2")))
+	_, _, err = readOnly.Commit()
+	assert.Equal(t, ErrNotWritable, err)
+
+	tree := readOnly.Tree()
+	k := zkt.NewHashFromBytes(bytes.Repeat([]byte{1}, 31))
+	assert.Equal(t, ErrNotWritable, tree.TryUpdate(k, 1, []zkt.Byte32{{2}}))
+	assert.Equal(t, ErrNotWritable, tree.TryDelete(k))
+	assert.Equal(t, ErrNotWritable, tree.BatchUpdate([]*zkt.Hash{k}, []LeafValue{{Flag: 1, Preimage: []zkt.Byte32{{2}}}}))
+	_, err = tree.addNode(NewLeafNode(k, 1, []zkt.Byte32{{2}}))
+	assert.Equal(t, ErrNotWritable, err)
+	_, err = tree.updateNode(NewLeafNode(k, 1, []zkt.Byte32{{2}}))
+	assert.Equal(t, ErrNotWritable, err)
+	assert.Equal(t, ErrNotWritable, tree.dbInsert(db, dbKeyRootNode, DBEntryTypeRoot, k[:]))
+	assert.Equal(t, root.Bytes(), readOnly.Hash())
+
+	// the view of a writable trie includes the uncommitted updates
+	assert.NoError(t, zkTrie.TryUpdate([]byte("key2"), 1, []zkt.Byte32{{2}}))
+	view := zkTrie.AsReadOnly()
+	assert.Equal(t, zkTrie.Hash(), view.Hash())
+	val, err = view.TryGet([]byte("key2"))
+	assert.NoError(t, err)
+	assert.Equal(t, (&zkt.Byte32{2}).Bytes(), val)
+	assert.Equal(t, ErrNotWritable, view.TryDelete([]byte("key2")))
+	assert.True(t, zkTrie.Tree().IsWritable())
+	assert.NoError(t, zkTrie.TryDelete([]byte("key2")))
+	assert.Equal(t, root.Bytes(), zkTrie.Hash())
+}
+
+func TestZkTrie_Account(t *testing.T) {
+	zkTrie, err := NewZkTrie(zkt.Byte32{}, NewZkTrieMemoryDb())
+	assert.NoError(t, err)
+	addr := bytes.Repeat([]byte{0xaa}, 20)
+
+	acc, err := zkTrie.GetAccount(addr)
+	assert.NoError(t, err)
+	assert.Nil(t, acc)
+
+	expected := &zkt.StateAccount{
+		Nonce:            3,
+		Balance:          big.NewInt(100),
+		StorageRoot:      zkt.Byte32{31: 1},
+		KeccakCodeHash:   zkt.Byte32{0: 0xff, 31: 2},
+		PoseidonCodeHash: zkt.Byte32{31: 3},
+		CodeSize:         4,
+	}
+	assert.NoError(t, zkTrie.UpdateAccount(addr, expected))
+	acc, err = zkTrie.GetAccount(addr)
+	assert.NoError(t, err)
+	assert.Equal(t, expected, acc)
+
+	// identical to the raw update with the spec layout
+	raw, err := NewZkTrie(zkt.Byte32{}, NewZkTrieMemoryDb())
+	assert.NoError(t, err)
+	vFlag, vPreimage := expected.Marshal()
+	assert.NoError(t, raw.TryUpdate(addr, vFlag, vPreimage))
+	assert.Equal(t, raw.Hash(), zkTrie.Hash())
+	val, err := zkTrie.TryGet(addr)
+	assert.NoError(t, err)
+	assert.Equal(t, 32*zkt.StateAccountFields, len(val))
+
+	assert.ErrorIs(t, zkTrie.UpdateAccount(addr, &zkt.StateAccount{Balance: big.NewInt(-1)}), zkt.ErrInvalidStateAccount)
+
+	// a storage value is not an account
+	assert.NoError(t, zkTrie.TryUpdate(addr, 1, []zkt.Byte32{{1}}))
+	_, err = zkTrie.GetAccount(addr)
+	assert.ErrorIs(t, err, zkt.ErrInvalidStateAccount)
+}
+
+func TestZkTrie_Storage(t *testing.T) {
+	zkTrie, err := NewZkTrie(zkt.Byte32{}, NewZkTrieMemoryDb())
+	assert.NoError(t, err)
+	slot := zkt.Byte32{31: 1}
+	value := zkt.Byte32{0: 0xff, 31: 2}
+
+	v, err := zkTrie.GetStorage(slot[:])
+	assert.NoError(t, err)
+	assert.Equal(t, zkt.Byte32{}, v)
+
+	assert.NoError(t, zkTrie.UpdateStorage(slot[:], value))
+	v, err = zkTrie.GetStorage(slot[:])
+	assert.NoError(t, err)
+	assert.Equal(t, value, v)
+
+	// identical to the raw update with the spec layout
+	raw, err := NewZkTrie(zkt.Byte32{}, NewZkTrieMemoryDb())
+	assert.NoError(t, err)
+	assert.NoError(t, raw.TryUpdate(slot[:], 1, []zkt.Byte32{value}))
+	assert.Equal(t, raw.Hash(), zkTrie.Hash())
+
+	// zero value deletes the slot
+	assert.NoError(t, zkTrie.UpdateStorage(slot[:], zkt.Byte32{}))
+	assert.Equal(t, zkt.HashZero.Bytes(), zkTrie.Hash())
+	v, err = zkTrie.GetStorage(slot[:])
+	assert.NoError(t, err)
+	assert.Equal(t, zkt.Byte32{}, v)
+	assert.NoError(t, zkTrie.UpdateStorage(slot[:], zkt.Byte32{}))
+	assert.NoError(t, zkTrie.DeleteStorage(slot[:]))
+
+	assert.NoError(t, zkTrie.UpdateStorage(slot[:], value))
+	assert.NoError(t, zkTrie.DeleteStorage(slot[:]))
+	assert.Equal(t, zkt.HashZero.Bytes(), zkTrie.Hash())
+
+	// an account is not a storage value
+	assert.NoError(t, zkTrie.UpdateAccount(slot[:], &zkt.StateAccount{Nonce: 1}))
+	_, err = zkTrie.GetStorage(slot[:])
+	assert.ErrorIs(t, err, ErrInvalidStorageValue)
+}
+
+func TestZkTrie_UpdateValueLength(t *testing.T) {
+	zkTrie, err := NewZkTrie(zkt.Byte32{}, NewZkTrieMemoryDb())
+	assert.NoError(t, err)
+
+	// empty value deletes the key
+	assert.NoError(t, zkTrie.TryUpdate([]byte("key"), 1, nil))
+	assert.NoError(t, zkTrie.TryUpdate([]byte("key"), 1, []zkt.Byte32{{1}}))
+	assert.NoError(t, zkTrie.TryUpdate([]byte("key"), 1, []zkt.Byte32{}))
+	assert.Equal(t, zkt.HashZero.Bytes(), zkTrie.Hash())
+	val, err := zkTrie.TryGet([]byte("key"))
+	assert.NoError(t, err)
+	assert.Nil(t, val)
+
+	assert.NoError(t, zkTrie.TryUpdate([]byte("key"), 0, make([]zkt.Byte32, 255)))
+	root := zkTrie.Hash()
+	assert.Equal(t, ErrInvalidValuePreimage, zkTrie.TryUpdate([]byte("key"), 0, make([]zkt.Byte32, 256)))
+	assert.Equal(t, root, zkTrie.Hash())
+	val, err = zkTrie.TryGet([]byte("key"))
+	assert.NoError(t, err)
+	assert.Equal(t, 255*32, len(val))
+
+	k := zkt.NewHashFromBytes([]byte{1})
+	assert.Equal(t, ErrInvalidValuePreimage, zkTrie.Tree().TryUpdate(k, 0, make([]zkt.Byte32, 256)))
+	assert.NoError(t, zkTrie.Tree().BatchUpdate([]*zkt.Hash{k}, []LeafValue{{Flag: 1}}))
+	assert.Equal(t, root, zkTrie.Hash())
+}
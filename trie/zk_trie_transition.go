@@ -0,0 +1,175 @@
+package trie
+
+import (
+	"bytes"
+	"errors"
+
+	zkt "github.com/scroll-tech/zktrie/types"
+)
+
+// TrieOpType is the type of an operation applied on a leaf
+type TrieOpType int
+
+const (
+	// TrieOpInsert inserts a leaf whose key is not existed in the trie
+	TrieOpInsert TrieOpType = iota
+	// TrieOpUpdate updates the value of an existed leaf
+	TrieOpUpdate
+	// TrieOpDelete deletes an existed leaf
+	TrieOpDelete
+)
+
+// TrieOperation is a single insertion, update or deletion of a leaf
+type TrieOperation struct {
+	Type    TrieOpType
+	NodeKey *zkt.Hash
+	// ValueFlag and ValuePreimage are the new value of the leaf, not used for deletion
+	ValueFlag     uint32
+	ValuePreimage []zkt.Byte32
+}
+
+var (
+	// ErrInvalidTransitionProof is used when the proof does not match the
+	// old root or the key of the operation
+	ErrInvalidTransitionProof = errors.New("proof is invalid for the transition")
+	// ErrInvalidTrieOperation is used when the operation can not be applied
+	ErrInvalidTrieOperation = errors.New("invalid trie operation")
+)
+
+// NewRootFromProof calculates the new root after applying op to the trie with
+// oldRoot, without accessing any database. The proof must be all the nodes on
+// the path of the key written by ZkTrie.Prove (with fromLevel 0). For a deletion,
+// the sibling of the deleted leaf provided by the onHit callback of
+// ZkTrie.ProveWithDeletion is also required (it is nil if the leaf is the only
+// one in the trie)
+func NewRootFromProof(oldRoot *zkt.Hash, proof []*Node, sibling *Node, op *TrieOperation) (*zkt.Hash, error) {
+	return NewRootFromProofWithHasher(zkt.DefaultHasher, oldRoot, proof, sibling, op)
+}
+
+// NewRootFromProofWithHasher is the same as NewRootFromProof but use the specified hash scheme
+func NewRootFromProofWithHasher(h zkt.Hasher, oldRoot *zkt.Hash, proof []*Node, sibling *Node, op *TrieOperation) (*zkt.Hash, error) {
+	maxLevels := NodeKeyValidBytes * 8
+	path := getPath(maxLevels, op.NodeKey[:])
+
+	// check the proof is a valid path of the key from oldRoot
+	if len(proof) == 0 || len(proof) > maxLevels {
+		return nil, ErrInvalidTransitionProof
+	}
+	var siblings []*zkt.Hash
+	expected := oldRoot
+	for i, n := range proof {
+		nodeHash, err := n.NodeHashWithHasher(h)
+		if err != nil {
+			return nil, err
+		}
+		if !bytes.Equal(nodeHash[:], expected[:]) {
+			return nil, ErrInvalidTransitionProof
+		}
+		if i == len(proof)-1 {
+			if n.Type != NodeTypeLeaf && n.Type != NodeTypeEmpty {
+				return nil, ErrInvalidTransitionProof
+			}
+			break
+		}
+		if n.Type != NodeTypeParent {
+			return nil, ErrInvalidTransitionProof
+		}
+		if path[i] {
+			expected = n.ChildR
+			siblings = append(siblings, n.ChildL)
+		} else {
+			expected = n.ChildL
+			siblings = append(siblings, n.ChildR)
+		}
+	}
+
+	terminal := proof[len(proof)-1]
+	hit := terminal.Type == NodeTypeLeaf && bytes.Equal(terminal.NodeKey[:], op.NodeKey[:])
+	lvl := len(siblings)
+
+	switch op.Type {
+	case TrieOpInsert, TrieOpUpdate:
+		if checkValuePreimage(op.ValuePreimage) != nil {
+			return nil, ErrInvalidTrieOperation
+		}
+		if op.Type == TrieOpInsert && hit {
+			return nil, ErrEntryIndexAlreadyExists
+		} else if op.Type == TrieOpUpdate && !hit {
+			return nil, ErrKeyNotFound
+		}
+		newLeaf := NewLeafNode(op.NodeKey, op.ValueFlag, op.ValuePreimage)
+		newHash, err := newLeaf.NodeHashWithHasher(h)
+		if err != nil {
+			return nil, err
+		}
+		if terminal.Type == NodeTypeLeaf && !hit {
+			// push down the old leaf until the paths diverge
+			oldHash, err := terminal.NodeHashWithHasher(h)
+			if err != nil {
+				return nil, err
+			}
+			oldPath := getPath(maxLevels, terminal.NodeKey[:])
+			// the deepest split is at maxLevels-2, as pushLeaf does
+			diverge := lvl
+			for diverge < maxLevels-2 && path[diverge] == oldPath[diverge] {
+				diverge++
+			}
+			if diverge > maxLevels-2 || path[diverge] == oldPath[diverge] {
+				return nil, ErrReachedMaxLevel
+			}
+			for i := lvl; i < diverge; i++ {
+				siblings = append(siblings, &zkt.HashZero)
+			}
+			siblings = append(siblings, oldHash)
+		}
+		return rootFromSiblings(h, path, newHash, siblings)
+	case TrieOpDelete:
+		if !hit {
+			return nil, ErrKeyNotFound
+		}
+		if lvl == 0 {
+			return &zkt.HashZero, nil
+		}
+		toUpload := siblings[lvl-1]
+		if sibling == nil {
+			return nil, ErrInvalidTransitionProof
+		}
+		sibHash, err := sibling.NodeHashWithHasher(h)
+		if err != nil {
+			return nil, err
+		}
+		if !bytes.Equal(sibHash[:], toUpload[:]) {
+			return nil, ErrInvalidTransitionProof
+		}
+		if sibling.Type == NodeTypeParent {
+			// simply replace the leaf with an empty node
+			return rootFromSiblings(h, path, &zkt.HashZero, siblings)
+		}
+		// contract the sibling leaf upward until it meets a non-empty sibling
+		for i := lvl - 2; i >= 0; i-- {
+			if !bytes.Equal(siblings[i][:], zkt.HashZero[:]) {
+				return rootFromSiblings(h, path, toUpload, siblings[:i+1])
+			}
+		}
+		return toUpload, nil
+	default:
+		return nil, ErrInvalidTrieOperation
+	}
+}
+
+// rootFromSiblings recalculates the hashes from the node at the end of the
+// path up to the root
+func rootFromSiblings(h zkt.Hasher, path []bool, nodeHash *zkt.Hash, siblings []*zkt.Hash) (*zkt.Hash, error) {
+	var err error
+	for i := len(siblings) - 1; i >= 0; i-- {
+		if path[i] {
+			nodeHash, err = NewParentNode(siblings[i], nodeHash).NodeHashWithHasher(h)
+		} else {
+			nodeHash, err = NewParentNode(nodeHash, siblings[i]).NodeHashWithHasher(h)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return nodeHash, nil
+}
@@ -0,0 +1,121 @@
+package trie
+
+import (
+	"testing"
+
+	zkt "github.com/scroll-tech/zktrie/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewRootFromProof(t *testing.T) {
+	zkTrie, err := NewZkTrie(zkt.Byte32{}, NewZkTrieMemoryDb())
+	assert.NoError(t, err)
+
+	proveKey := func(key []byte) (*zkt.Hash, []*Node, *Node) {
+		k, err := zkt.ToSecureKey(key)
+		assert.NoError(t, err)
+		nodeKey := zkt.NewHashFromBigInt(k)
+		var proof []*Node
+		var sibling *Node
+		err = zkTrie.ProveWithDeletion(nodeKey.Bytes(), 0, func(n *Node) error {
+			proof = append(proof, n)
+			return nil
+		}, func(_ *Node, sib *Node) {
+			sibling = sib
+		})
+		assert.NoError(t, err)
+		return nodeKey, proof, sibling
+	}
+
+	apply := func(key []byte, op TrieOpType, v byte) {
+		oldRoot := zkt.NewHashFromBytes(zkTrie.Hash())
+		nodeKey, proof, sibling := proveKey(key)
+		newRoot, err := NewRootFromProof(oldRoot, proof, sibling, &TrieOperation{
+			Type:          op,
+			NodeKey:       nodeKey,
+			ValueFlag:     1,
+			ValuePreimage: []zkt.Byte32{{v}},
+		})
+		assert.NoError(t, err)
+
+		if op == TrieOpDelete {
+			assert.NoError(t, zkTrie.TryDelete(key))
+		} else {
+			assert.NoError(t, zkTrie.TryUpdate(key, 1, []zkt.Byte32{{v}}))
+		}
+		assert.Equal(t, zkTrie.Hash(), newRoot.Bytes())
+	}
+
+	keys := make([][]byte, 32)
+	for i := range keys {
+		keys[i] = make([]byte, 32)
+		keys[i][31] = byte(i + 1)
+	}
+
+	for i, key := range keys {
+		apply(key, TrieOpInsert, byte(i))
+	}
+	for i, key := range keys {
+		apply(key, TrieOpUpdate, byte(i+100))
+	}
+
+	// operations which do not match the proof
+	nodeKey, proof, sibling := proveKey(keys[0])
+	root := zkt.NewHashFromBytes(zkTrie.Hash())
+	_, err = NewRootFromProof(root, proof, sibling, &TrieOperation{Type: TrieOpInsert, NodeKey: nodeKey, ValuePreimage: []zkt.Byte32{{1}}})
+	assert.Equal(t, ErrEntryIndexAlreadyExists, err)
+	_, err = NewRootFromProof(root, proof, nil, &TrieOperation{Type: TrieOpDelete, NodeKey: nodeKey})
+	assert.Equal(t, ErrInvalidTransitionProof, err)
+	_, err = NewRootFromProof(&zkt.HashZero, proof, sibling, &TrieOperation{Type: TrieOpDelete, NodeKey: nodeKey})
+	assert.Equal(t, ErrInvalidTransitionProof, err)
+	_, err = NewRootFromProof(root, proof[:len(proof)-1], sibling, &TrieOperation{Type: TrieOpDelete, NodeKey: nodeKey})
+	assert.Equal(t, ErrInvalidTransitionProof, err)
+
+	missing := make([]byte, 32)
+	missing[31] = 0xff
+	nodeKey, proof, sibling = proveKey(missing)
+	_, err = NewRootFromProof(root, proof, sibling, &TrieOperation{Type: TrieOpUpdate, NodeKey: nodeKey, ValuePreimage: []zkt.Byte32{{1}}})
+	assert.Equal(t, ErrKeyNotFound, err)
+	_, err = NewRootFromProof(root, proof, sibling, &TrieOperation{Type: TrieOpDelete, NodeKey: nodeKey})
+	assert.Equal(t, ErrKeyNotFound, err)
+
+	for _, key := range keys {
+		apply(key, TrieOpDelete, 0)
+	}
+	assert.Equal(t, zkt.HashZero.Bytes(), zkTrie.Hash())
+}
+
+func TestNewRootFromProof_MaxLevel(t *testing.T) {
+	zkTrie, err := NewZkTrie(zkt.Byte32{}, NewZkTrieMemoryDb())
+	assert.NoError(t, err)
+
+	// the paths of the keys diverge at the last level, where the trie can
+	// not split
+	k0 := &zkt.Hash{1}
+	k1 := &zkt.Hash{1}
+	k1[NodeKeyValidBytes-1] = 0x80
+	assert.NoError(t, zkTrie.Tree().TryUpdate(k0, 1, []zkt.Byte32{{1}}))
+	assert.Equal(t, ErrReachedMaxLevel, zkTrie.Tree().TryUpdate(k1, 1, []zkt.Byte32{{2}}))
+
+	var proof []*Node
+	assert.NoError(t, zkTrie.Prove(k1.Bytes(), 0, func(n *Node) error {
+		proof = append(proof, n)
+		return nil
+	}))
+	root := zkt.NewHashFromBytes(zkTrie.Hash())
+	_, err = NewRootFromProof(root, proof, nil, &TrieOperation{Type: TrieOpInsert, NodeKey: k1, ValueFlag: 1, ValuePreimage: []zkt.Byte32{{2}}})
+	assert.Equal(t, ErrReachedMaxLevel, err)
+
+	// one level above is still allowed
+	k2 := &zkt.Hash{1}
+	k2[NodeKeyValidBytes-1] = 0x40
+	proof = proof[:0]
+	assert.NoError(t, zkTrie.Prove(k2.Bytes(), 0, func(n *Node) error {
+		proof = append(proof, n)
+		return nil
+	}))
+	newRoot, err := NewRootFromProof(root, proof, nil, &TrieOperation{Type: TrieOpInsert, NodeKey: k2, ValueFlag: 1, ValuePreimage: []zkt.Byte32{{3}}})
+	assert.NoError(t, err)
+	assert.NoError(t, zkTrie.Tree().TryUpdate(k2, 1, []zkt.Byte32{{3}}))
+	assert.Equal(t, zkTrie.Hash(), newRoot.Bytes())
+}
@@ -0,0 +1,144 @@
+package trie
+
+import (
+	"bytes"
+	"math/big"
+	"sort"
+	"sync"
+
+	zkt "github.com/scroll-tech/zktrie/types"
+)
+
+// WitnessRecorder is a ZktrieDatabase wrapper which records every trie node
+// read from the underlying db, so the nodes touched by a sequence of
+// TryGet/TryUpdate/TryDelete (including the siblings resolved for collapsing
+// the path after deletions) can be collected as the witness of the execution.
+// Feeding the recorded nodes into a fresh db (e.g. by InitDbByNode) is enough
+// to replay the same operations from the same root. It is safe for concurrent
+// use.
+//
+// Only the reads reaching the recorder are recorded, so a trie must be opened
+// on the recorder before the execution starts, and the nodes created during
+// the execution are not recorded as they are resolved from the dirty set. The
+// nodes resolved through GetNode are recorded too, so the hits of a wrapped
+// NodeCache are not missed.
+type WitnessRecorder struct {
+	db ZktrieDatabase
+
+	lock  sync.Mutex
+	nodes map[zkt.Hash][]byte
+}
+
+// NewWitnessRecorder wraps db with a recorder
+func NewWitnessRecorder(db ZktrieDatabase) *WitnessRecorder {
+	return &WitnessRecorder{
+		db:    db,
+		nodes: make(map[zkt.Hash][]byte),
+	}
+}
+
+// UpdatePreimage records the key preimage in the underlying db
+func (r *WitnessRecorder) UpdatePreimage(preimage []byte, hashField *big.Int) {
+	r.db.UpdatePreimage(preimage, hashField)
+}
+
+// Preimage returns the key preimage from the underlying db
+func (r *WitnessRecorder) Preimage(hashField *big.Int) ([]byte, bool) {
+	return r.db.Preimage(hashField)
+}
+
+// Put writes into the underlying db without recording
+func (r *WitnessRecorder) Put(k, v []byte) error {
+	return r.db.Put(k, v)
+}
+
+// Get reads the key from the underlying db and records it if it is a node
+func (r *WitnessRecorder) Get(key []byte) ([]byte, error) {
+	v, err := r.db.Get(key)
+	if err != nil || len(key) != zkt.HashByteLen {
+		return v, err
+	}
+	if _, err := NewNodeFromBytes(v); err != nil {
+		// not a node
+		return v, nil
+	}
+
+	var nodeHash zkt.Hash
+	copy(nodeHash[:], key)
+	r.record(nodeHash, v)
+	return v, nil
+}
+
+// GetNode resolves the node from the underlying db and records it, through
+// the GetNode of the underlying db if it implements NodeReader
+func (r *WitnessRecorder) GetNode(nodeHash *zkt.Hash) (*Node, error) {
+	reader, ok := r.db.(NodeReader)
+	if !ok {
+		v, err := r.Get(nodeHash[:])
+		if err != nil {
+			return nil, err
+		}
+		return NewNodeFromBytes(v)
+	}
+
+	n, err := reader.GetNode(nodeHash)
+	if err != nil {
+		return nil, err
+	}
+	r.record(*nodeHash, n.CanonicalValue())
+	return n, nil
+}
+
+func (r *WitnessRecorder) record(nodeHash zkt.Hash, v []byte) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if _, ok := r.nodes[nodeHash]; !ok {
+		r.nodes[nodeHash] = append([]byte{}, v...)
+	}
+}
+
+// NewBatch creates a batch of the underlying db, see NodeCache.NewBatch
+func (r *WitnessRecorder) NewBatch() Batch {
+	if batcher, ok := r.db.(Batcher); ok {
+		return batcher.NewBatch()
+	}
+	return &putBatch{db: r.db}
+}
+
+// Nodes returns the encoded bytes of the recorded nodes, deduplicated and
+// sorted by node hash. Each of them is in the format accepted by
+// DecodeSMTProof and InitDbByNode
+func (r *WitnessRecorder) Nodes() [][]byte {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	hashes := make([]zkt.Hash, 0, len(r.nodes))
+	for h := range r.nodes {
+		hashes = append(hashes, h)
+	}
+	sort.Slice(hashes, func(i, j int) bool {
+		return bytes.Compare(hashes[i][:], hashes[j][:]) < 0
+	})
+	ret := make([][]byte, len(hashes))
+	for i, h := range hashes {
+		ret[i] = r.nodes[h]
+	}
+	return ret
+}
+
+// Len returns the number of the recorded nodes
+func (r *WitnessRecorder) Len() int {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	return len(r.nodes)
+}
+
+// Reset clears the recorded nodes
+func (r *WitnessRecorder) Reset() {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.nodes = make(map[zkt.Hash][]byte)
+}
@@ -0,0 +1,130 @@
+package trie
+
+import (
+	"testing"
+
+	zkt "github.com/scroll-tech/zktrie/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWitnessRecorder(t *testing.T) {
+	key := func(i int) []byte {
+		k := make([]byte, 32)
+		k[30], k[31] = byte(i>>8), byte(i)
+		return k
+	}
+
+	db := NewZkTrieMemoryDb()
+	zkTrie, err := NewZkTrie(zkt.Byte32{}, db)
+	assert.NoError(t, err)
+	for i := 0; i < 64; i++ {
+		assert.NoError(t, zkTrie.TryUpdate(key(i), 1, []zkt.Byte32{{byte(i)}}))
+	}
+	root, _, err := zkTrie.Commit()
+	assert.NoError(t, err)
+	totalNodes := 0
+	assert.NoError(t, zkTrie.Tree().Walk(root, func(n *Node) {
+		if n.Type != NodeTypeEmpty {
+			totalNodes++
+		}
+	}))
+
+	// executes the same operations and returns the read values and the new root
+	execute := func(db ZktrieDatabase) ([][]byte, []byte) {
+		tr, err := NewZkTrie(*zkt.NewByte32FromBytes(root.Bytes()), db)
+		assert.NoError(t, err)
+		var reads [][]byte
+		for _, i := range []int{3, 17, 100} {
+			v, err := tr.TryGet(key(i))
+			assert.NoError(t, err)
+			reads = append(reads, v)
+		}
+		assert.NoError(t, tr.TryUpdate(key(5), 1, []zkt.Byte32{{5, 5}}))
+		assert.NoError(t, tr.TryUpdate(key(200), 1, []zkt.Byte32{{200}}))
+		for _, i := range []int{8, 40, 41, 63} {
+			assert.NoError(t, tr.TryDelete(key(i)))
+		}
+		return reads, tr.Hash()
+	}
+
+	recorder := NewWitnessRecorder(db)
+	expectedReads, expectedRoot := execute(recorder)
+	assert.Greater(t, recorder.Len(), 0)
+	assert.Less(t, recorder.Len(), totalNodes)
+	witness := recorder.Nodes()
+	assert.Equal(t, recorder.Len(), len(witness))
+
+	// replay on a db initialized by the witness only, as InitDbByNode does
+	replayDb := NewZkTrieMemoryDb()
+	for _, data := range witness {
+		n, err := DecodeSMTProof(data)
+		assert.NoError(t, err)
+		hash, err := n.NodeHash()
+		assert.NoError(t, err)
+		assert.NoError(t, replayDb.Put(hash[:], n.CanonicalValue()))
+	}
+	reads, newRoot := execute(replayDb)
+	assert.Equal(t, expectedReads, reads)
+	assert.Equal(t, expectedRoot, newRoot)
+
+	// the nodes are recorded once
+	execute(recorder)
+	assert.Equal(t, len(witness), recorder.Len())
+
+	recorder.Reset()
+	assert.Equal(t, 0, recorder.Len())
+	assert.Empty(t, recorder.Nodes())
+}
+
+func TestWitnessRecorder_NodeCache(t *testing.T) {
+	key := func(i int) []byte {
+		k := make([]byte, 32)
+		k[31] = byte(i)
+		return k
+	}
+
+	db := NewZkTrieMemoryDb()
+	zkTrie, err := NewZkTrie(zkt.Byte32{}, db)
+	assert.NoError(t, err)
+	for i := 1; i <= 32; i++ {
+		assert.NoError(t, zkTrie.TryUpdate(key(i), 1, []zkt.Byte32{{byte(i)}}))
+	}
+	root, _, err := zkTrie.Commit()
+	assert.NoError(t, err)
+
+	execute := func(db ZktrieDatabase) ([][]byte, []byte) {
+		tr, err := NewZkTrie(*zkt.NewByte32FromBytes(root.Bytes()), db)
+		assert.NoError(t, err)
+		var reads [][]byte
+		for _, i := range []int{3, 17} {
+			v, err := tr.TryGet(key(i))
+			assert.NoError(t, err)
+			reads = append(reads, v)
+		}
+		assert.NoError(t, tr.TryUpdate(key(5), 1, []zkt.Byte32{{5, 5}}))
+		assert.NoError(t, tr.TryDelete(key(9)))
+		return reads, tr.Hash()
+	}
+
+	// warm up the cache, so the nodes are resolved by cache hits
+	cache := NewNodeCache(db, 1024)
+	execute(cache)
+	hits := cache.Stats().Hits
+
+	recorder := NewWitnessRecorder(cache)
+	expectedReads, expectedRoot := execute(recorder)
+	assert.Greater(t, cache.Stats().Hits, hits)
+	assert.Greater(t, recorder.Len(), 0)
+
+	replayDb := NewZkTrieMemoryDb()
+	for _, data := range recorder.Nodes() {
+		n, err := DecodeSMTProof(data)
+		assert.NoError(t, err)
+		hash, err := n.NodeHash()
+		assert.NoError(t, err)
+		assert.NoError(t, replayDb.Put(hash[:], n.CanonicalValue()))
+	}
+	reads, newRoot := execute(replayDb)
+	assert.Equal(t, expectedReads, reads)
+	assert.Equal(t, expectedRoot, newRoot)
+}
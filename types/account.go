@@ -0,0 +1,90 @@
+package zktrie
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+const (
+	// StateAccountFlag is the compression flag of a marshaled state account,
+	// only the keccak codehash (field 3) can not be treated as a field element
+	StateAccountFlag uint32 = 1 << 3
+	// StateAccountFields is the number of 32 bytes fields of a marshaled
+	// state account
+	StateAccountFields = 5
+)
+
+// ErrInvalidStateAccount is returned when the state account can not be
+// marshaled or the value is not a marshaled state account
+var ErrInvalidStateAccount = errors.New("invalid state account")
+
+// StateAccount is the account stored in the leaf of the state trie
+type StateAccount struct {
+	Nonce            uint64
+	Balance          *big.Int // must be a field element
+	StorageRoot      Byte32   // must be a field element
+	KeccakCodeHash   Byte32
+	PoseidonCodeHash Byte32 // must be a field element
+	CodeSize         uint64
+}
+
+// Validate checks the fields which are treated as field elements fit inside
+// the finite field
+func (acc *StateAccount) Validate() error {
+	if acc.Balance != nil && (acc.Balance.Sign() < 0 || !CheckBigIntInField(acc.Balance)) {
+		return fmt.Errorf("%w: balance not inside the finite field", ErrInvalidStateAccount)
+	}
+	if !CheckBigIntInField(new(big.Int).SetBytes(acc.StorageRoot[:])) {
+		return fmt.Errorf("%w: storage root not inside the finite field", ErrInvalidStateAccount)
+	}
+	if !CheckBigIntInField(new(big.Int).SetBytes(acc.PoseidonCodeHash[:])) {
+		return fmt.Errorf("%w: poseidon codehash not inside the finite field", ErrInvalidStateAccount)
+	}
+	return nil
+}
+
+// Marshal encodes the account into the flag and value preimage of a leaf,
+// the layout is (all in big-endian)
+//
+//	[0:32]    reserved 16 bytes of 0 || CodeSize (8 bytes) || Nonce (8 bytes)
+//	[32:64]   Balance
+//	[64:96]   StorageRoot
+//	[96:128]  KeccakCodeHash
+//	[128:160] PoseidonCodeHash
+//
+// The account is expected to be valid, see Validate
+func (acc *StateAccount) Marshal() (uint32, []Byte32) {
+	fields := make([]Byte32, StateAccountFields)
+	binary.BigEndian.PutUint64(fields[0][16:24], acc.CodeSize)
+	binary.BigEndian.PutUint64(fields[0][24:32], acc.Nonce)
+	if acc.Balance != nil {
+		fields[1] = *NewByte32FromBytes(acc.Balance.Bytes())
+	}
+	fields[2] = acc.StorageRoot
+	fields[3] = acc.KeccakCodeHash
+	fields[4] = acc.PoseidonCodeHash
+	return StateAccountFlag, fields
+}
+
+// Unmarshal decodes the account from the flag and value preimage of a leaf
+// encoded by Marshal
+func (acc *StateAccount) Unmarshal(flag uint32, fields []Byte32) error {
+	if flag != StateAccountFlag || len(fields) != StateAccountFields {
+		return fmt.Errorf("%w: unexpected flag %d with %d fields", ErrInvalidStateAccount, flag, len(fields))
+	}
+	for _, b := range fields[0][:16] {
+		if b != 0 {
+			return fmt.Errorf("%w: non-zero reserved bytes", ErrInvalidStateAccount)
+		}
+	}
+
+	acc.CodeSize = binary.BigEndian.Uint64(fields[0][16:24])
+	acc.Nonce = binary.BigEndian.Uint64(fields[0][24:32])
+	acc.Balance = new(big.Int).SetBytes(fields[1][:])
+	acc.StorageRoot = fields[2]
+	acc.KeccakCodeHash = fields[3]
+	acc.PoseidonCodeHash = fields[4]
+	return acc.Validate()
+}
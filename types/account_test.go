@@ -0,0 +1,61 @@
+package zktrie
+
+import (
+	"bytes"
+	"math/big"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStateAccountMarshal(t *testing.T) {
+	acc := &StateAccount{
+		Nonce:            0x0102,
+		Balance:          big.NewInt(0x030405),
+		StorageRoot:      Byte32{31: 6},
+		KeccakCodeHash:   *NewByte32FromBytesPaddingZero(bytes.Repeat([]byte{0xff}, 32)),
+		PoseidonCodeHash: Byte32{31: 7},
+		CodeSize:         0x0809,
+	}
+	assert.NoError(t, acc.Validate())
+
+	flag, fields := acc.Marshal()
+	assert.Equal(t, uint32(8), flag)
+	assert.Equal(t, StateAccountFields, len(fields))
+	assert.Equal(t, Byte32{22: 0x08, 23: 0x09, 30: 0x01, 31: 0x02}, fields[0])
+	assert.Equal(t, Byte32{29: 0x03, 30: 0x04, 31: 0x05}, fields[1])
+	assert.Equal(t, acc.StorageRoot, fields[2])
+	assert.Equal(t, acc.KeccakCodeHash, fields[3])
+	assert.Equal(t, acc.PoseidonCodeHash, fields[4])
+
+	var decoded StateAccount
+	assert.NoError(t, decoded.Unmarshal(flag, fields))
+	assert.Equal(t, acc, &decoded)
+
+	// nil balance is encoded as 0
+	flag, fields = (&StateAccount{Nonce: 1}).Marshal()
+	assert.NoError(t, decoded.Unmarshal(flag, fields))
+	assert.Equal(t, 0, decoded.Balance.Sign())
+}
+
+func TestStateAccountInvalid(t *testing.T) {
+	overflow := *NewByte32FromBytes(Q.Bytes())
+	for _, acc := range []*StateAccount{
+		{Balance: big.NewInt(-1)},
+		{Balance: new(big.Int).Set(Q)},
+		{StorageRoot: overflow},
+		{PoseidonCodeHash: overflow},
+	} {
+		assert.ErrorIs(t, acc.Validate(), ErrInvalidStateAccount)
+	}
+
+	flag, fields := (&StateAccount{Nonce: 1}).Marshal()
+	var acc StateAccount
+	assert.ErrorIs(t, acc.Unmarshal(4, fields), ErrInvalidStateAccount)
+	assert.ErrorIs(t, acc.Unmarshal(flag, fields[:4]), ErrInvalidStateAccount)
+	fields[0][0] = 1
+	assert.ErrorIs(t, acc.Unmarshal(flag, fields), ErrInvalidStateAccount)
+	fields[0][0] = 0
+	fields[2] = overflow
+	assert.ErrorIs(t, acc.Unmarshal(flag, fields), ErrInvalidStateAccount)
+}
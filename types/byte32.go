@@ -7,9 +7,14 @@ import (
 type Byte32 [32]byte
 
 func (b *Byte32) Hash() (*big.Int, error) {
+	return b.HashWithHasher(DefaultHasher)
+}
+
+// HashWithHasher is the same as Hash but use the specified hash scheme
+func (b *Byte32) HashWithHasher(h Hasher) (*big.Int, error) {
 	first16 := new(big.Int).SetBytes(b[0:16])
 	last16 := new(big.Int).SetBytes(b[16:32])
-	hash, err := hashScheme([]*big.Int{first16, last16})
+	hash, err := h.Hash([]*big.Int{first16, last16})
 	if err != nil {
 		return nil, err
 	}
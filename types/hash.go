@@ -9,13 +9,10 @@ import (
 
 var Q *big.Int
 var setHashScheme sync.Once
-var hashNotInitErr = fmt.Errorf("hash scheme is not setup yet, call InitHashScheme before using the library")
 
-func dummyHash([]*big.Int) (*big.Int, error) {
-	return big.NewInt(0), hashNotInitErr
-}
-
-var hashScheme func([]*big.Int) (*big.Int, error) = dummyHash
+// hashScheme is default to the built-in poseidon hash and can be replaced
+// by InitHashScheme
+var hashScheme func([]*big.Int) (*big.Int, error) = PoseidonHash
 
 func init() {
 	qString := "21888242871839275222246405745257275088548364400416034343698204186575808495617"
@@ -26,12 +23,42 @@ func init() {
 	}
 }
 
+// InitHashScheme replaces the built-in poseidon hash with an external
+// implementation, only the first call take effect
 func InitHashScheme(f func([]*big.Int) (*big.Int, error)) {
 	setHashScheme.Do(func() {
 		hashScheme = f
 	})
 }
 
+// Hasher is the hash scheme which reduces 2 field elements into one, it is
+// used for calculating node keys and node hashes of a trie
+type Hasher interface {
+	Hash([]*big.Int) (*big.Int, error)
+}
+
+// HashSchemeFunc adapts a plain hash function to the Hasher interface
+type HashSchemeFunc func([]*big.Int) (*big.Int, error)
+
+// Hash implements Hasher
+func (f HashSchemeFunc) Hash(inp []*big.Int) (*big.Int, error) {
+	return f(inp)
+}
+
+type globalHasher struct{}
+
+func (globalHasher) Hash(inp []*big.Int) (*big.Int, error) {
+	return hashScheme(inp)
+}
+
+// DefaultHasher is the process-wide hash scheme, which is the built-in
+// poseidon hash unless it has been replaced by InitHashScheme
+var DefaultHasher Hasher = globalHasher{}
+
+// PoseidonHasher always uses the built-in poseidon hash regardless of
+// InitHashScheme
+var PoseidonHasher Hasher = HashSchemeFunc(PoseidonHash)
+
 // CheckBigIntInField checks if given *big.Int fits in a Field Q element
 func CheckBigIntInField(a *big.Int) bool {
 	return a.Cmp(Q) == -1
@@ -55,8 +82,11 @@ func (h Hash) MarshalText() ([]byte, error) {
 // UnmarshalText implements the unmarshaler for the Hash type
 func (h *Hash) UnmarshalText(b []byte) error {
 	ha, err := NewHashFromString(string(b))
+	if err != nil {
+		return err
+	}
 	copy(h[:], ha[:])
-	return err
+	return nil
 }
 
 // String returns decimal representation in string format of the Hash
@@ -130,7 +160,7 @@ func NewHashFromCheckedBytes(b []byte) (*Hash, error) {
 // NewHashFromString returns a *Hash representation of the given decimal string
 func NewHashFromString(s string) (*Hash, error) {
 	bi, ok := new(big.Int).SetString(s, 10)
-	if !ok {
+	if !ok || bi.Sign() < 0 || bi.BitLen() > HashByteLen*8 {
 		return nil, fmt.Errorf("cannot parse the string to Hash")
 	}
 	return NewHashFromBigInt(bi), nil
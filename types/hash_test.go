@@ -9,12 +9,6 @@ import (
 	"github.com/stretchr/testify/assert"
 )
 
-func TestDummyHash(t *testing.T) {
-	result, err := dummyHash([]*big.Int{})
-	assert.Equal(t, big.NewInt(0), result)
-	assert.Equal(t, hashNotInitErr, err)
-}
-
 func TestCheckBigIntInField(t *testing.T) {
 	bi := big.NewInt(0)
 	assert.True(t, CheckBigIntInField(bi))
@@ -77,3 +71,11 @@ func TestNewHashFromBigIntAndString(t *testing.T) {
 	assert.Equal(t, "0101010101010101010101010101010101010101010101010101010101010101", h.Hex())
 	assert.Equal(t, "45408662...", h.String())
 }
+
+func TestHashUnmarshalTextInvalid(t *testing.T) {
+	var h Hash
+	for _, s := range []string{"", "abc", "-1", new(big.Int).Lsh(big.NewInt(1), 256).String()} {
+		assert.Error(t, h.UnmarshalText([]byte(s)))
+	}
+	assert.Equal(t, HashZero, h)
+}
@@ -0,0 +1,167 @@
+package zktrie
+
+import (
+	"errors"
+	"math/big"
+	"sync"
+)
+
+// Poseidon parameters for the BN254 scalar field with width 3 (2 inputs and
+// 1 capacity element initialized to 0), x^5 S-box, 8 full rounds and 57
+// partial rounds. The round constants and the MDS matrix are derived with the
+// Grain LFSR exactly as the reference parameter script does, so the result is
+// compatible with circomlib / go-iden3-crypto poseidon
+const (
+	poseidonWidth    = 3
+	poseidonFullRnd  = 8
+	poseidonPartRnd  = 57
+	poseidonFieldBit = 254
+)
+
+var (
+	// ErrPoseidonInputLen is returned when the poseidon hash is called with
+	// an input size other than 2
+	ErrPoseidonInputLen = errors.New("poseidon hash accepts exactly 2 inputs")
+	// ErrPoseidonInputNotInField is returned when any input is not inside
+	// the finite field
+	ErrPoseidonInputNotInField = errors.New("poseidon input not inside the finite field")
+
+	poseidonC          []*big.Int
+	poseidonM          [poseidonWidth][poseidonWidth]*big.Int
+	poseidonParamsOnce sync.Once
+)
+
+// grainLFSR is the 80-bit self-shrinking LFSR used to generate poseidon
+// parameters
+type grainLFSR struct {
+	state [80]byte
+}
+
+func newGrainLFSR(field, sbox, n, t, rf, rp int) *grainLFSR {
+	g := &grainLFSR{}
+	pos := 0
+	push := func(v, width int) {
+		for i := width - 1; i >= 0; i-- {
+			g.state[pos] = byte((v >> i) & 1)
+			pos++
+		}
+	}
+	push(field, 2)
+	push(sbox, 4)
+	push(n, 12)
+	push(t, 12)
+	push(rf, 10)
+	push(rp, 10)
+	for ; pos < len(g.state); pos++ {
+		g.state[pos] = 1
+	}
+
+	// discard the first 160 bits
+	for i := 0; i < 160; i++ {
+		g.step()
+	}
+	return g
+}
+
+func (g *grainLFSR) step() byte {
+	s := &g.state
+	b := s[62] ^ s[51] ^ s[38] ^ s[23] ^ s[13] ^ s[0]
+	copy(s[:], s[1:])
+	s[len(s)-1] = b
+	return b
+}
+
+// nextBit outputs bits in pairs: a bit is kept only if the previous one is 1
+func (g *grainLFSR) nextBit() byte {
+	for {
+		if g.step() == 1 {
+			return g.step()
+		}
+		g.step()
+	}
+}
+
+func (g *grainLFSR) nextBits(n int) *big.Int {
+	r := new(big.Int)
+	for i := 0; i < n; i++ {
+		r.Lsh(r, 1)
+		if g.nextBit() == 1 {
+			r.SetBit(r, 0, 1)
+		}
+	}
+	return r
+}
+
+func initPoseidonParams() {
+	g := newGrainLFSR(1, 0, poseidonFieldBit, poseidonWidth, poseidonFullRnd, poseidonPartRnd)
+
+	poseidonC = make([]*big.Int, (poseidonFullRnd+poseidonPartRnd)*poseidonWidth)
+	for i := range poseidonC {
+		c := g.nextBits(poseidonFieldBit)
+		for !CheckBigIntInField(c) {
+			c = g.nextBits(poseidonFieldBit)
+		}
+		poseidonC[i] = c
+	}
+
+	// cauchy matrix M[i][j] = 1 / (x_i + y_j)
+	var xy [2 * poseidonWidth]*big.Int
+	for i := range xy {
+		xy[i] = new(big.Int).Mod(g.nextBits(poseidonFieldBit), Q)
+	}
+	for i := 0; i < poseidonWidth; i++ {
+		for j := 0; j < poseidonWidth; j++ {
+			s := new(big.Int).Add(xy[i], xy[poseidonWidth+j])
+			poseidonM[i][j] = s.ModInverse(s.Mod(s, Q), Q)
+		}
+	}
+}
+
+// PoseidonHash computes the poseidon hash of 2 field elements with an initial
+// capacity of 0, it can be used as the hash scheme for the trie
+func PoseidonHash(inp []*big.Int) (*big.Int, error) {
+	if len(inp) != poseidonWidth-1 {
+		return nil, ErrPoseidonInputLen
+	}
+	poseidonParamsOnce.Do(initPoseidonParams)
+
+	state := make([]*big.Int, poseidonWidth)
+	state[0] = new(big.Int)
+	for i, in := range inp {
+		if in.Sign() < 0 || !CheckBigIntInField(in) {
+			return nil, ErrPoseidonInputNotInField
+		}
+		state[i+1] = new(big.Int).Set(in)
+	}
+
+	five := big.NewInt(5)
+	tmp := new(big.Int)
+	next := make([]*big.Int, poseidonWidth)
+	for i := range next {
+		next[i] = new(big.Int)
+	}
+
+	for r := 0; r < poseidonFullRnd+poseidonPartRnd; r++ {
+		for i := range state {
+			state[i].Add(state[i], poseidonC[r*poseidonWidth+i])
+		}
+
+		fullRound := r < poseidonFullRnd/2 || r >= poseidonFullRnd/2+poseidonPartRnd
+		for i := range state {
+			if fullRound || i == 0 {
+				state[i].Exp(state[i], five, Q)
+			}
+		}
+
+		for i := range next {
+			next[i].SetInt64(0)
+			for j := range state {
+				next[i].Add(next[i], tmp.Mul(poseidonM[i][j], state[j]))
+			}
+			next[i].Mod(next[i], Q)
+		}
+		state, next = next, state
+	}
+
+	return state[0], nil
+}
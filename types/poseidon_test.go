@@ -0,0 +1,31 @@
+package zktrie
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPoseidonHash(t *testing.T) {
+	h, err := PoseidonHash([]*big.Int{big.NewInt(1), big.NewInt(2)})
+	assert.NoError(t, err)
+	assert.Equal(t, "7853200120776062878684798364095072458815029376092732009249414926327459813530", h.String())
+
+	h, err = PoseidonHash([]*big.Int{big.NewInt(0), big.NewInt(0)})
+	assert.NoError(t, err)
+	assert.Equal(t, "14744269619966411208579211824598458697587494354926760081771325075741142829156", h.String())
+
+	_, err = PoseidonHash([]*big.Int{big.NewInt(1)})
+	assert.Equal(t, ErrPoseidonInputLen, err)
+
+	_, err = PoseidonHash([]*big.Int{big.NewInt(1), new(big.Int).Set(Q)})
+	assert.Equal(t, ErrPoseidonInputNotInField, err)
+}
+
+func TestPoseidonParams(t *testing.T) {
+	poseidonParamsOnce.Do(initPoseidonParams)
+	assert.Equal(t, (poseidonFullRnd+poseidonPartRnd)*poseidonWidth, len(poseidonC))
+	assert.Equal(t, "6745197990210204598374042828761989596302876299545964402857411729872131034734", poseidonC[0].String())
+	assert.Equal(t, "7511745149465107256748700652201246547602992235352608707588321460060273774987", poseidonM[0][0].String())
+}
@@ -7,16 +7,21 @@ import (
 // HashElems performs a recursive poseidon hash over the array of ElemBytes, each hash
 // reduce 2 fieds into one
 func HashElems(fst, snd *big.Int, elems ...*big.Int) (*Hash, error) {
+	return HashElemsWithHasher(DefaultHasher, fst, snd, elems...)
+}
+
+// HashElemsWithHasher is the same as HashElems but use the specified hash scheme
+func HashElemsWithHasher(h Hasher, fst, snd *big.Int, elems ...*big.Int) (*Hash, error) {
 
 	l := len(elems)
-	baseH, err := hashScheme([]*big.Int{fst, snd})
+	baseH, err := h.Hash([]*big.Int{fst, snd})
 	if err != nil {
 		return nil, err
 	}
 	if l == 0 {
 		return NewHashFromBigInt(baseH), nil
 	} else if l == 1 {
-		return HashElems(baseH, elems[0])
+		return HashElemsWithHasher(h, baseH, elems[0])
 	}
 
 	tmp := make([]*big.Int, (l+1)/2)
@@ -24,27 +29,32 @@ func HashElems(fst, snd *big.Int, elems ...*big.Int) (*Hash, error) {
 		if (i+1)*2 > l {
 			tmp[i] = elems[i*2]
 		} else {
-			h, err := hashScheme(elems[i*2 : (i+1)*2])
+			hElem, err := h.Hash(elems[i*2 : (i+1)*2])
 			if err != nil {
 				return nil, err
 			}
-			tmp[i] = h
+			tmp[i] = hElem
 		}
 	}
 
-	return HashElems(baseH, tmp[0], tmp[1:]...)
+	return HashElemsWithHasher(h, baseH, tmp[0], tmp[1:]...)
 }
 
 // PreHandlingElems turn persisted byte32 elements into field arrays for our hashElem
 // it also has the compressed byte32
 func PreHandlingElems(flagArray uint32, elems []Byte32) (*Hash, error) {
+	return PreHandlingElemsWithHasher(DefaultHasher, flagArray, elems)
+}
+
+// PreHandlingElemsWithHasher is the same as PreHandlingElems but use the specified hash scheme
+func PreHandlingElemsWithHasher(h Hasher, flagArray uint32, elems []Byte32) (*Hash, error) {
 
 	ret := make([]*big.Int, len(elems))
 	var err error
 
 	for i, elem := range elems {
 		if flagArray&(1<<i) != 0 {
-			ret[i], err = elem.Hash()
+			ret[i], err = elem.HashWithHasher(h)
 			if err != nil {
 				return nil, err
 			}
@@ -57,7 +67,7 @@ func PreHandlingElems(flagArray uint32, elems []Byte32) (*Hash, error) {
 		return NewHashFromBigInt(ret[0]), nil
 	}
 
-	return HashElems(ret[0], ret[1], ret[2:]...)
+	return HashElemsWithHasher(h, ret[0], ret[1], ret[2:]...)
 
 }
 
@@ -92,8 +102,13 @@ func BigEndianBitsToBigInt(bits []bool) *big.Int {
 
 // ToSecureKey turn the byte key into the integer represent of "secured" key
 func ToSecureKey(key []byte) (*big.Int, error) {
+	return ToSecureKeyWithHasher(DefaultHasher, key)
+}
+
+// ToSecureKeyWithHasher is the same as ToSecureKey but use the specified hash scheme
+func ToSecureKeyWithHasher(h Hasher, key []byte) (*big.Int, error) {
 	word := NewByte32FromBytesPaddingZero(key)
-	return word.Hash()
+	return word.HashWithHasher(h)
 }
 
 // ToSecureKeyBytes turn the byte key into a 32-byte "secured" key, which represented a big-endian integer
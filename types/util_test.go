@@ -98,3 +98,20 @@ func TestPreHandlingElems(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Equal(t, "0000000000000000000000000000000000000000000000000000007465737431", result.Hex())
 }
+
+func TestHashElemsWithHasher(t *testing.T) {
+	result, err := HashElemsWithHasher(PoseidonHasher, big.NewInt(1), big.NewInt(2))
+	assert.NoError(t, err)
+	assert.Equal(t, "7853200120776062878684798364095072458815029376092732009249414926327459813530", result.BigInt().String())
+
+	mockResult, err := HashElemsWithHasher(DefaultHasher, big.NewInt(1), big.NewInt(2))
+	assert.NoError(t, err)
+	assert.NotEqual(t, result, mockResult)
+
+	elems := []Byte32{*NewByte32FromBytes([]byte("test1")), *NewByte32FromBytes([]byte("test2"))}
+	mockResult, err = PreHandlingElems(1, elems)
+	assert.NoError(t, err)
+	result, err = PreHandlingElemsWithHasher(DefaultHasher, 1, elems)
+	assert.NoError(t, err)
+	assert.Equal(t, mockResult, result)
+}